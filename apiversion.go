@@ -0,0 +1,53 @@
+package otelmetricsecho
+
+import (
+	"mime"
+	"strings"
+)
+
+const apiVersionUnknown = "unknown"
+
+// apiVersionFromAccept extracts the API version from an Accept header, either from a vendor media type such
+// as "application/vnd.myapp.v2+json" or from a version parameter such as "application/json; version=2".
+// The first media range carrying a version wins; "unknown" is returned when none does.
+func apiVersionFromAccept(header string) string {
+	for _, mediaRange := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		for _, name := range []string{"version", "v"} {
+			if version, ok := apiVersion(params[name]); ok {
+				return version
+			}
+		}
+
+		_, subtype, _ := strings.Cut(mediaType, "/")
+		for _, segment := range strings.FieldsFunc(subtype, func(r rune) bool { return r == '.' || r == '+' }) {
+			if strings.HasPrefix(segment, "v") {
+				if version, ok := apiVersion(segment); ok {
+					return version
+				}
+			}
+		}
+	}
+
+	return apiVersionUnknown
+}
+
+// apiVersion normalizes "2" and "v2" to "v2". Anything but a short number is rejected to keep the attribute
+// low-cardinality.
+func apiVersion(value string) (string, bool) {
+	digits := strings.TrimPrefix(strings.ToLower(value), "v")
+	if digits == "" || len(digits) > 4 {
+		return "", false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+
+	return "v" + digits, true
+}
@@ -0,0 +1,73 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestAPIVersionFromAccept(t *testing.T) {
+	tests := map[string]string{
+		"":                                       apiVersionUnknown,
+		"application/json":                       apiVersionUnknown,
+		"application/vnd.myapp.v2+json":          "v2",
+		"application/json; version=3":            "v3",
+		"application/json; v=v4":                 "v4",
+		"text/html, application/vnd.app.v1+json": "v1",
+		"application/json; version=latest":       apiVersionUnknown,
+		"application/vnd.app.v123456+json":       apiVersionUnknown,
+	}
+	for header, want := range tests {
+		if got := apiVersionFromAccept(header); got != want {
+			t.Errorf("apiVersionFromAccept(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// apiVersions returns requests_total by api.version
+func apiVersions(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	t.Helper()
+
+	versions := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		version, _ := point.Attributes.Value(attrAPIVersion)
+		versions[version.AsString()] = point.Value
+	}
+
+	return versions
+}
+
+func TestAPIVersionAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{APIVersionFromAccept: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for _, accept := range []string{"application/vnd.myapp.v2+json", "application/json; version=2", "application/json"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAccept, accept)
+		serve(e, req)
+	}
+
+	if versions, want := apiVersions(t, reader), map[string]int64{"v2": 2, apiVersionUnknown: 1}; !maps.Equal(versions, want) {
+		t.Fatalf("api.version = %v, want %v", versions, want)
+	}
+}
+
+func TestAPIVersionFunc(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		APIVersionFromAccept: true,
+		APIVersionFunc:       func(c echo.Context) string { return c.QueryParam("api") },
+	})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for _, target := range []string{"/?api=beta", "/"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(echo.HeaderAccept, "application/vnd.myapp.v2+json")
+		serve(e, req)
+	}
+
+	if versions, want := apiVersions(t, reader), map[string]int64{"beta": 1, apiVersionUnknown: 1}; !maps.Equal(versions, want) {
+		t.Fatalf("api.version = %v, want %v", versions, want)
+	}
+}
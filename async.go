@@ -0,0 +1,74 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+const defaultAsyncQueueSize = 1024
+
+// asyncRecorder performs recordings on a background goroutine. When the queue is full, or the recorder
+// has been shut down, recordings are dropped and counted.
+type asyncRecorder struct {
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan func()
+	done    chan struct{}
+	dropped metric.Int64Counter
+	// droppedAttrs holds the attributes dropped measurements are counted with
+	droppedAttrs metric.AddOption
+}
+
+func newAsyncRecorder(size int, dropped metric.Int64Counter, droppedAttrs metric.AddOption) *asyncRecorder {
+	r := &asyncRecorder{
+		queue:        make(chan func(), size),
+		done:         make(chan struct{}),
+		dropped:      dropped,
+		droppedAttrs: droppedAttrs,
+	}
+	go r.run()
+
+	return r
+}
+
+func (r *asyncRecorder) run() {
+	defer close(r.done)
+
+	for record := range r.queue {
+		record()
+	}
+}
+
+func (r *asyncRecorder) push(ctx context.Context, record func()) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.closed {
+		select {
+		case r.queue <- record:
+			return
+		default:
+		}
+	}
+
+	r.dropped.Add(ctx, 1, r.droppedAttrs)
+}
+
+// shutdown stops accepting recordings and waits until the queued ones are recorded or ctx is done
+func (r *asyncRecorder) shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
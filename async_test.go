@@ -0,0 +1,162 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestAsyncRecordingRequiresShutdown(t *testing.T) {
+	conf := MiddlewareConfig{MeterProvider: sdkmetric.NewMeterProvider(), AsyncRecording: true}
+	if _, err := conf.ToMiddleware(); !errors.Is(err, errAsyncWithoutShutdown) {
+		t.Errorf("ToMiddleware error = %v, want %v", err, errAsyncWithoutShutdown)
+	}
+	if _, _, err := conf.ToMiddlewareWithInstruments(); !errors.Is(err, errAsyncWithoutShutdown) {
+		t.Errorf("ToMiddlewareWithInstruments error = %v, want %v", err, errAsyncWithoutShutdown)
+	}
+
+	_, shutdown, err := conf.ToMiddlewareWithShutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncRecorderOrder(t *testing.T) {
+	r := newAsyncRecorder(100, nil, nil)
+	var got []int
+	for i := range 100 {
+		r.push(context.Background(), func() { got = append(got, i) })
+	}
+	if err := r.shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]int, 100)
+	for i := range want {
+		want[i] = i
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("recordings ran in order %v, want %v", got, want)
+	}
+}
+
+func TestAsyncRecorderOverflow(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	dropped, err := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test").Int64Counter(metricDroppedTotal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := MiddlewareConfig{StaticAttributes: []attribute.KeyValue{attribute.String("env", "test")}}
+	r := newAsyncRecorder(1, dropped, conf.attributesFor(metricDroppedTotal, nil))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	r.push(context.Background(), func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	var recorded int
+	for range 3 {
+		r.push(context.Background(), func() { recorded++ })
+	}
+	close(release)
+	if err := r.shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if recorded != 1 {
+		t.Fatalf("%d queued recordings ran, want 1", recorded)
+	}
+	point := singleSum(t, collect(t, reader), metricDroppedTotal)
+	if point.Value != 2 {
+		t.Fatalf("metrics_dropped_total = %d, want 2", point.Value)
+	}
+	assertAttr(t, point.Attributes, "env", attribute.StringValue("test"))
+}
+
+func TestAsyncRecorderShutdownTimeout(t *testing.T) {
+	r := newAsyncRecorder(1, nil, nil)
+	release := make(chan struct{})
+	defer close(release)
+	r.push(context.Background(), func() { <-release })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.shutdown(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("shutdown error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestAsyncRecordingDrainsOnShutdown(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mw, shutdown, err := MiddlewareConfig{
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		AsyncRecording: true,
+	}.ToMiddlewareWithShutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for range 10 {
+		get(e, "/")
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	metrics := collect(t, reader)
+	if got := singleSum(t, metrics, metricHTTPRequestsTotal).Value; got != 10 {
+		t.Fatalf("requests_total = %d, want 10", got)
+	}
+	if got := singleHistogram(t, metrics, metricHTTPRequestDurationSeconds).Count; got != 10 {
+		t.Fatalf("request_duration_seconds count = %d, want 10", got)
+	}
+
+	// recordings after shutdown are dropped
+	get(e, "/")
+	metrics = collect(t, reader)
+	if got := singleSum(t, metrics, metricHTTPRequestsTotal).Value; got != 10 {
+		t.Fatalf("requests_total after shutdown = %d, want 10", got)
+	}
+	if got := singleSum(t, metrics, metricDroppedTotal).Value; got != 1 {
+		t.Fatalf("metrics_dropped_total = %d, want 1", got)
+	}
+}
+
+func TestShutdownIdempotent(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mw, shutdown := NewMiddlewareWithShutdown(MiddlewareConfig{
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		AsyncRecording: true,
+	})
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for range 5 {
+		get(e, "/")
+	}
+
+	for i := range 3 {
+		if err := shutdown(context.Background()); err != nil {
+			t.Fatalf("shutdown #%d: %v", i+1, err)
+		}
+	}
+	if got := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Value; got != 5 {
+		t.Fatalf("requests_total = %d, want 5", got)
+	}
+	if times := lastRequests(t, reader); len(times) != 0 {
+		t.Fatalf("last_request_timestamp_seconds = %v after shutdown, want none", times)
+	}
+}
@@ -0,0 +1,34 @@
+package otelmetricsecho
+
+import (
+	"io"
+	"time"
+)
+
+// countingReadCloser counts bytes read from the wrapped body
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// timingReadCloser measures the time spent reading the wrapped body
+type timingReadCloser struct {
+	io.ReadCloser
+	now   func() time.Time
+	reads int
+	d     time.Duration
+}
+
+func (r *timingReadCloser) Read(p []byte) (int, error) {
+	start := r.now()
+	n, err := r.ReadCloser.Read(p)
+	r.d += r.now().Sub(start)
+	r.reads++
+	return n, err
+}
@@ -0,0 +1,81 @@
+package otelmetricsecho
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func chunkedRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+
+	return req
+}
+
+func TestCountChunkedBody(t *testing.T) {
+	readAll := func(c echo.Context) error {
+		if _, err := io.Copy(io.Discard, c.Request().Body); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	}
+	body := strings.Repeat("x", 1000)
+
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.POST("/upload", readAll)
+	serve(e, chunkedRequest(body))
+	without := singleHistogram(t, collect(t, reader), metricHTTPRequestSizeBytes).Sum
+
+	e, reader = newTestEcho(t, MiddlewareConfig{CountChunkedBody: true})
+	e.POST("/upload", readAll)
+	serve(e, chunkedRequest(body))
+	with := singleHistogram(t, collect(t, reader), metricHTTPRequestSizeBytes).Sum
+
+	if with-without != float64(len(body)) {
+		t.Fatalf("request size with CountChunkedBody = %v, without = %v; want a difference of %d", with, without, len(body))
+	}
+}
+
+func TestCountChunkedBodyUnread(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{CountChunkedBody: true})
+	e.POST("/upload", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	serve(e, chunkedRequest(strings.Repeat("x", 1000)))
+
+	if size := singleHistogram(t, collect(t, reader), metricHTTPRequestSizeBytes).Sum; size >= 1000 {
+		t.Fatalf("request size = %v, want unread body bytes not counted", size)
+	}
+}
+
+func TestMeasureBodyReadTime(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{MeasureBodyReadTime: true, TimeNow: fakeClock(time.Millisecond)})
+	body := strings.Repeat("x", 1<<20)
+	e.POST("/upload", func(c echo.Context) error {
+		data, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, strconv.Itoa(len(data)))
+	})
+	e.POST("/ignore", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	rec := serve(e, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(body)))
+	serve(e, httptest.NewRequest(http.MethodPost, "/ignore", strings.NewReader(body)))
+
+	if rec.Body.String() != strconv.Itoa(len(body)) {
+		t.Fatalf("handler read %s bytes, want %d", rec.Body.String(), len(body))
+	}
+	point := singleHistogram(t, collect(t, reader), metricRequestBodyReadSeconds)
+	assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/upload"))
+	if point.Count != 1 || point.Sum <= 0 {
+		t.Fatalf("request_body_read_seconds count = %d sum = %v, want a single positive value", point.Count, point.Sum)
+	}
+}
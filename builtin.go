@@ -0,0 +1,27 @@
+package otelmetricsecho
+
+// BuiltinAttributes selects the built-in attributes recorded with the request metrics.
+type BuiltinAttributes uint
+
+const (
+	// BuiltinRoute records http.route.
+	BuiltinRoute BuiltinAttributes = 1 << iota
+	// BuiltinMethod records http.request.method and http.request.method_original.
+	BuiltinMethod
+	// BuiltinHost records server.address.
+	BuiltinHost
+	// BuiltinScheme records url.scheme.
+	BuiltinScheme
+	// BuiltinStatus records http.response.status_code.
+	BuiltinStatus
+	// BuiltinService records service.name, service.instance.id, service.version and deployment.environment.
+	BuiltinService
+)
+
+// DefaultBuiltinAttributes is used when MiddlewareConfig.BuiltinAttributes is zero. server.address is left
+// out as the Host header is set by the client.
+const DefaultBuiltinAttributes = BuiltinRoute | BuiltinMethod | BuiltinScheme | BuiltinStatus | BuiltinService
+
+func (b BuiltinAttributes) has(attr BuiltinAttributes) bool {
+	return b&attr != 0
+}
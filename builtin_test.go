@@ -0,0 +1,52 @@
+package otelmetricsecho
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestBuiltinAttributes(t *testing.T) {
+	all := []attribute.Key{
+		semconv.HTTPRouteKey,
+		semconv.HTTPRequestMethodKey,
+		semconv.ServerAddressKey,
+		semconv.URLSchemeKey,
+		semconv.HTTPResponseStatusCodeKey,
+		semconv.ServiceNameKey,
+		semconv.ServiceInstanceIDKey,
+		semconv.DeploymentEnvironmentKey,
+	}
+	tests := []struct {
+		name     string
+		builtins BuiltinAttributes
+		want     []attribute.Key
+	}{
+		{"default", 0, []attribute.Key{
+			semconv.HTTPRouteKey, semconv.HTTPRequestMethodKey, semconv.URLSchemeKey, semconv.HTTPResponseStatusCodeKey,
+			semconv.ServiceNameKey, semconv.ServiceInstanceIDKey, semconv.DeploymentEnvironmentKey,
+		}},
+		{"route and status", BuiltinRoute | BuiltinStatus, []attribute.Key{semconv.HTTPRouteKey, semconv.HTTPResponseStatusCodeKey}},
+		{"host", BuiltinHost, []attribute.Key{semconv.ServerAddressKey}},
+		{"service", BuiltinService, []attribute.Key{semconv.ServiceNameKey, semconv.ServiceInstanceIDKey, semconv.DeploymentEnvironmentKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, reader := newTestEcho(t, MiddlewareConfig{BuiltinAttributes: tt.builtins})
+			get(e, "/")
+
+			for name, attrs := range requestAttributes(t, collect(t, reader)) {
+				want := make(map[attribute.Key]bool)
+				for _, key := range tt.want {
+					want[key] = true
+				}
+				for _, key := range all {
+					if _, ok := attrs.Value(key); ok != want[key] {
+						t.Errorf("%s has %s = %t, want %t", name, key, ok, want[key])
+					}
+				}
+			}
+		})
+	}
+}
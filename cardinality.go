@@ -0,0 +1,95 @@
+package otelmetricsecho
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const overflowRoute = "__overflow__"
+
+// routeLimiter bounds the number of distinct route values. Once max routes have been seen, any new route
+// is replaced with overflowRoute.
+type routeLimiter struct {
+	mu   sync.RWMutex
+	max  int
+	seen map[string]struct{}
+}
+
+func newRouteLimiter(max int) *routeLimiter {
+	return &routeLimiter{
+		max:  max,
+		seen: make(map[string]struct{}, max),
+	}
+}
+
+func (l *routeLimiter) route(route string) string {
+	l.mu.RLock()
+	_, ok := l.seen[route]
+	l.mu.RUnlock()
+	if ok {
+		return route
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.seen[route]; ok {
+		return route
+	}
+	if len(l.seen) >= l.max {
+		return overflowRoute
+	}
+	l.seen[route] = struct{}{}
+
+	return route
+}
+
+// overflowSet is the attribute set the OTel SDK records measurements with once an instrument's
+// cardinality limit is reached
+var overflowSet = attribute.NewSet(attribute.Bool("otel.metric.overflow", true))
+
+// attributeSetLimiter bounds the attribute sets recorded per metric for MiddlewareConfig.CardinalityLimit.
+// Like the SDK limiter, limit includes the overflow set.
+type attributeSetLimiter struct {
+	mu    sync.RWMutex
+	limit int
+	seen  map[string]map[attribute.Distinct]struct{}
+}
+
+func newAttributeSetLimiter(limit int) *attributeSetLimiter {
+	return &attributeSetLimiter{
+		limit: limit,
+		seen:  make(map[string]map[attribute.Distinct]struct{}),
+	}
+}
+
+// set returns set, or overflowSet when recording it would exceed the limit of the metric
+func (l *attributeSetLimiter) set(name string, set attribute.Set) attribute.Set {
+	key := set.Equivalent()
+
+	l.mu.RLock()
+	_, ok := l.seen[name][key]
+	l.mu.RUnlock()
+	if ok {
+		return set
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seen, ok := l.seen[name]
+	if !ok {
+		seen = make(map[attribute.Distinct]struct{})
+		l.seen[name] = seen
+	}
+	if _, ok := seen[key]; ok {
+		return set
+	}
+	if len(seen) >= l.limit-1 {
+		return overflowSet
+	}
+	seen[key] = struct{}{}
+
+	return set
+}
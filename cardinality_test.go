@@ -0,0 +1,78 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestMaxRouteCardinality(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{MaxRouteCardinality: 2})
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/a"} {
+		get(e, path)
+	}
+
+	if got, want := routes(t, reader), map[string]int64{"/a": 2, "/b": 1, overflowRoute: 2}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func TestRouteLimiter(t *testing.T) {
+	limiter := newRouteLimiter(1)
+	if got := limiter.route("/a"); got != "/a" {
+		t.Fatalf("first route = %q, want /a", got)
+	}
+	if got := limiter.route("/b"); got != overflowRoute {
+		t.Fatalf("route over the limit = %q, want %q", got, overflowRoute)
+	}
+	if got := limiter.route("/a"); got != "/a" {
+		t.Fatalf("seen route = %q, want /a", got)
+	}
+}
+
+func TestCardinalityLimit(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{CardinalityLimit: 3})
+	for _, path := range []string{"/a", "/b", "/c", "/d", "/a"} {
+		e.GET(path, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		get(e, path)
+	}
+
+	counts := make(map[string]int64)
+	var overflow int64
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		if point.Attributes.Equals(&overflowSet) {
+			overflow += point.Value
+			continue
+		}
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		counts[route.AsString()] = point.Value
+	}
+	if want := map[string]int64{"/a": 2, "/b": 1}; !maps.Equal(counts, want) {
+		t.Fatalf("requests_total by route = %v, want %v", counts, want)
+	}
+	if overflow != 2 {
+		t.Fatalf("requests_total with otel.metric.overflow=true = %d, want 2", overflow)
+	}
+}
+
+func TestAttributeSetLimiter(t *testing.T) {
+	limiter := newAttributeSetLimiter(2)
+	a := attribute.NewSet(attribute.String("k", "a"))
+	b := attribute.NewSet(attribute.String("k", "b"))
+	if got := limiter.set("m", a); !got.Equals(&a) {
+		t.Fatalf("first set = %v, want %v", got, a)
+	}
+	if got := limiter.set("m", b); !got.Equals(&overflowSet) {
+		t.Fatalf("set over the limit = %v, want otel.metric.overflow=true", got)
+	}
+	if got := limiter.set("other", b); !got.Equals(&b) {
+		t.Fatalf("set of another metric = %v, want %v", got, b)
+	}
+	if v, ok := overflowSet.Value("otel.metric.overflow"); !ok || !v.AsBool() {
+		t.Fatalf("overflow set = %v, want otel.metric.overflow=true", overflowSet)
+	}
+}
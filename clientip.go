@@ -0,0 +1,32 @@
+package otelmetricsecho
+
+import (
+	"net/netip"
+)
+
+const (
+	clientIPv4PrefixBits = 24
+	clientIPv6PrefixBits = 48
+)
+
+// truncateClientIP returns the network of ip, /24 for IPv4 and /48 for IPv6, e.g. "203.0.113.0/24" for
+// "203.0.113.42". Unparsable addresses are "unknown".
+func truncateClientIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "unknown"
+	}
+
+	addr = addr.Unmap()
+	bits := clientIPv6PrefixBits
+	if addr.Is4() {
+		bits = clientIPv4PrefixBits
+	}
+
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return "unknown"
+	}
+
+	return prefix.String()
+}
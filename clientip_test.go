@@ -0,0 +1,50 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestTruncateClientIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.42":        "203.0.113.0/24",
+		"::ffff:203.0.113.42": "203.0.113.0/24",
+		"2001:db8:1:2::1":     "2001:db8:1::/48",
+		"fe80::1%eth0":        "fe80::/48",
+		"not-an-ip":           "unknown",
+		"":                    "unknown",
+	}
+	for ip, want := range tests {
+		if got := truncateClientIP(ip); got != want {
+			t.Errorf("truncateClientIP(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestClientIPAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{ClientIPAttribute: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.7:51234"
+	serve(e, req)
+
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ClientAddressKey, attribute.StringValue("198.51.100.0/24"))
+}
+
+func TestClientIPFunc(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		ClientIPAttribute: true,
+		ClientIPFunc:      func(ip string) string { return "hashed:" + ip },
+	})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRealIP, "192.0.2.1")
+	serve(e, req)
+
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ClientAddressKey, attribute.StringValue("hashed:192.0.2.1"))
+}
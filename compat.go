@@ -0,0 +1,27 @@
+package otelmetricsecho
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+const compatibilityNamespace = "http"
+
+// compatibilityKeys maps attribute keys to the labels of the echo-contrib Prometheus middleware
+var compatibilityKeys = map[attribute.Key]attribute.Key{
+	semconv.HTTPResponseStatusCodeKey: "code",
+	semconv.HTTPRequestMethodKey:      "method",
+	semconv.HTTPRouteKey:              "url",
+	semconv.ServerAddressKey:          "host",
+}
+
+// compatibilityAttributes renames attributes to their echo-contrib label in place, leaving others unchanged
+func compatibilityAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	for i, kv := range attrs {
+		if key, ok := compatibilityKeys[kv.Key]; ok {
+			attrs[i] = attribute.KeyValue{Key: key, Value: kv.Value}
+		}
+	}
+
+	return attrs
+}
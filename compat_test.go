@@ -0,0 +1,70 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestCompatibilityAttributes(t *testing.T) {
+	got := compatibilityAttributes([]attribute.KeyValue{
+		semconv.HTTPResponseStatusCode(http.StatusOK),
+		semconv.HTTPRequestMethodKey.String(http.MethodGet),
+		semconv.HTTPRoute("/users/:id"),
+		semconv.ServerAddress("example.com"),
+		semconv.URLScheme("https"),
+	})
+	want := []attribute.KeyValue{
+		attribute.Int("code", http.StatusOK),
+		attribute.String("method", http.MethodGet),
+		attribute.String("url", "/users/:id"),
+		attribute.String("host", "example.com"),
+		semconv.URLScheme("https"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("compatibilityAttributes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("attribute %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCompatibilityMode(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{CompatibilityMode: true})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+
+	metrics := collect(t, reader)
+	for _, name := range requestMetrics {
+		if _, ok := metrics[name]; ok {
+			t.Errorf("%s recorded without the http_ prefix", name)
+		}
+	}
+	for _, name := range requestMetrics {
+		point := sumOrHistogramAttributes(t, metrics, compatibilityNamespace+"_"+name)
+		assertAttr(t, point, "code", attribute.IntValue(http.StatusOK))
+		assertAttr(t, point, "method", attribute.StringValue(http.MethodGet))
+		assertAttr(t, point, "url", attribute.StringValue("/users/:id"))
+		assertAttr(t, point, "host", attribute.StringValue("example.com"))
+		for _, key := range []attribute.Key{semconv.HTTPResponseStatusCodeKey, semconv.HTTPRequestMethodKey, semconv.HTTPRouteKey, semconv.ServerAddressKey} {
+			assertNoAttr(t, point, key)
+		}
+	}
+}
+
+// sumOrHistogramAttributes returns the attributes of the single data point of the named counter or histogram
+func sumOrHistogramAttributes(t *testing.T, metrics map[string]metricdata.Metrics, name string) attribute.Set {
+	t.Helper()
+
+	if _, ok := metrics[name].Data.(metricdata.Sum[int64]); ok {
+		return singleSum(t, metrics, name).Attributes
+	}
+
+	return singleHistogram(t, metrics, name).Attributes
+}
@@ -0,0 +1,46 @@
+package otelmetricsecho
+
+import (
+	"strings"
+)
+
+const (
+	contentTypeUnknown = "unknown"
+	contentTypeOther   = "other"
+)
+
+// contentTypes maps media types to the low-cardinality values recorded as attributes
+var contentTypes = map[string]string{
+	"application/json":                  "json",
+	"application/x-www-form-urlencoded": "form",
+	"multipart/form-data":               "multipart",
+	"application/xml":                   "xml",
+	"text/xml":                          "xml",
+	"text/plain":                        "text",
+	"text/html":                         "html",
+	"application/protobuf":              "protobuf",
+	"application/x-protobuf":            "protobuf",
+	"application/octet-stream":          "binary",
+}
+
+// normalizeContentType reduces a Content-Type header value to a small set of values, e.g. "json" for
+// "application/json; charset=utf-8". Empty header is "unknown", unrecognised media types are "other".
+func normalizeContentType(header string) string {
+	mediaType, _, _ := strings.Cut(header, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" {
+		return contentTypeUnknown
+	}
+
+	if normalized, ok := contentTypes[mediaType]; ok {
+		return normalized
+	}
+	if strings.HasSuffix(mediaType, "+json") {
+		return "json"
+	}
+	if strings.HasSuffix(mediaType, "+xml") {
+		return "xml"
+	}
+
+	return contentTypeOther
+}
@@ -0,0 +1,72 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNormalizeContentType(t *testing.T) {
+	tests := map[string]string{
+		"":                                  contentTypeUnknown,
+		"application/json":                  "json",
+		"Application/JSON; charset=utf-8":   "json",
+		"application/problem+json":          "json",
+		"application/x-www-form-urlencoded": "form",
+		"multipart/form-data; boundary=xyz": "multipart",
+		"text/xml":                          "xml",
+		"application/atom+xml":              "xml",
+		"application/x-protobuf":            "protobuf",
+		"image/png":                         contentTypeOther,
+	}
+	for header, want := range tests {
+		if got := normalizeContentType(header); got != want {
+			t.Errorf("normalizeContentType(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestContentTypeAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{ContentTypeAttribute: true})
+	e.POST("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for _, contentType := range []string{"application/json; charset=utf-8", "application/vnd.api+json", "image/png", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		if contentType != "" {
+			req.Header.Set(echo.HeaderContentType, contentType)
+		}
+		serve(e, req)
+	}
+
+	types := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		contentType, _ := point.Attributes.Value(attrRequestContent)
+		types[contentType.AsString()] = point.Value
+	}
+	if want := map[string]int64{"json": 2, "other": 1, "unknown": 1}; !maps.Equal(types, want) {
+		t.Fatalf("http.request.content_type = %v, want %v", types, want)
+	}
+}
+
+func TestResponseContentTypeAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{ResponseContentTypeAttribute: true})
+	e.GET("/json", func(c echo.Context) error { return c.JSON(http.StatusOK, map[string]string{"ok": "yes"}) })
+	e.GET("/html", func(c echo.Context) error { return c.HTML(http.StatusOK, "<p>ok</p>") })
+	e.GET("/empty", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	get(e, "/json")
+	get(e, "/json")
+	get(e, "/html")
+	get(e, "/empty")
+
+	types := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		contentType, _ := point.Attributes.Value(attrResponseContent)
+		types[contentType.AsString()] = point.Value
+	}
+	if want := map[string]int64{"json": 2, "html": 1, "unknown": 1}; !maps.Equal(types, want) {
+		t.Fatalf("http.response.content_type = %v, want %v", types, want)
+	}
+}
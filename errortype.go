@@ -0,0 +1,37 @@
+package otelmetricsecho
+
+import (
+	"errors"
+	"fmt"
+)
+
+const errorTypeOther = "other"
+
+// errorTypes lists the error types recorded by name; other types are recorded as "other"
+var errorTypes = map[string]struct{}{
+	"*echo.HTTPError":               {},
+	"*echo.BindingError":            {},
+	"context.deadlineExceededError": {},
+	"*net.OpError":                  {},
+	"*url.Error":                    {},
+	"*json.SyntaxError":             {},
+	"*json.UnmarshalTypeError":      {},
+	"*strconv.NumError":             {},
+}
+
+// errorType returns the name of the first type in the chain of err found in errorTypes, "other" when there
+// is none, or empty string for nil err
+func errorType(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		name := fmt.Sprintf("%T", e)
+		if _, ok := errorTypes[name]; ok {
+			return name
+		}
+	}
+
+	return errorTypeOther
+}
@@ -0,0 +1,84 @@
+package otelmetricsecho
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+type customError struct{}
+
+func (customError) Error() string { return "custom" }
+
+func TestErrorType(t *testing.T) {
+	_, numErr := strconv.Atoi("x")
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{echo.ErrNotFound, "*echo.HTTPError"},
+		{fmt.Errorf("wrapped: %w", numErr), "*strconv.NumError"},
+		{customError{}, errorTypeOther},
+		{errors.New("plain"), errorTypeOther},
+	}
+	for _, tt := range tests {
+		if got := errorType(tt.err); got != tt.want {
+			t.Errorf("errorType(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorTypeAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{ErrorTypeAttribute: true})
+	e.GET("/http", func(c echo.Context) error { return echo.ErrBadRequest })
+	e.GET("/custom", func(c echo.Context) error { return customError{} })
+	e.GET("/ok", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/http")
+	get(e, "/custom")
+	get(e, "/ok")
+
+	types := make(map[string]string)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		errType, _ := point.Attributes.Value(semconv.ErrorTypeKey)
+		types[route.AsString()] = errType.AsString()
+	}
+	want := map[string]string{"/http": "*echo.HTTPError", "/custom": errorTypeOther, "/ok": ""}
+	if !maps.Equal(types, want) {
+		t.Fatalf("error.type by route = %v, want %v", types, want)
+	}
+}
+
+func TestErrorTypeFunc(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		ErrorTypeAttribute: true,
+		ErrorTypeFunc: func(err error) string {
+			if errors.Is(err, echo.ErrNotFound) {
+				return ""
+			}
+			return "app"
+		},
+	})
+	e.GET("/custom", func(c echo.Context) error { return customError{} })
+	e.GET("/missing", func(c echo.Context) error { return echo.ErrNotFound })
+	get(e, "/custom")
+	get(e, "/missing")
+
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		switch route.AsString() {
+		case "/custom":
+			assertAttr(t, point.Attributes, semconv.ErrorTypeKey, attribute.StringValue("app"))
+		case "/missing":
+			assertNoAttr(t, point.Attributes, semconv.ErrorTypeKey)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const headerGRPCStatus = "Grpc-Status"
+
+// grpcStatus returns the gRPC status code sent in the grpc-status response header or trailer
+func grpcStatus(header http.Header) (int, bool) {
+	value := header.Get(headerGRPCStatus)
+	if value == "" {
+		value = header.Get(http.TrailerPrefix + headerGRPCStatus)
+	}
+	if value == "" {
+		return 0, false
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 0 {
+		return 0, false
+	}
+
+	return code, true
+}
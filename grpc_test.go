@@ -0,0 +1,55 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestGRPCStatus(t *testing.T) {
+	tests := []struct {
+		header http.Header
+		code   int
+		ok     bool
+	}{
+		{http.Header{}, 0, false},
+		{http.Header{"Grpc-Status": {"0"}}, 0, true},
+		{http.Header{"Grpc-Status": {"5"}}, 5, true},
+		{http.Header{http.TrailerPrefix + "Grpc-Status": {"14"}}, 14, true},
+		{http.Header{"Grpc-Status": {"unavailable"}}, 0, false},
+		{http.Header{"Grpc-Status": {"-1"}}, 0, false},
+	}
+	for _, tt := range tests {
+		if code, ok := grpcStatus(tt.header); code != tt.code || ok != tt.ok {
+			t.Errorf("grpcStatus(%v) = %d, %t, want %d, %t", tt.header, code, ok, tt.code, tt.ok)
+		}
+	}
+}
+
+func TestGRPCStatusAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{GRPCStatusAttribute: true})
+	e.POST("/grpc", func(c echo.Context) error {
+		c.Response().Header().Set(http.TrailerPrefix+headerGRPCStatus, "5")
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/rest", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	serve(e, httptest.NewRequest(http.MethodPost, "/grpc", nil))
+	get(e, "/rest")
+
+	points := sumPoints(t, collect(t, reader), metricHTTPRequestsTotal)
+	if len(points) != 2 {
+		t.Fatalf("requests_total has %d points, want 2", len(points))
+	}
+	for _, point := range points {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		if route.AsString() == "/grpc" {
+			assertAttr(t, point.Attributes, semconv.RPCGRPCStatusCodeKey, attribute.IntValue(5))
+		} else {
+			assertNoAttr(t, point.Attributes, semconv.RPCGRPCStatusCodeKey)
+		}
+	}
+}
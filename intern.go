@@ -0,0 +1,55 @@
+package otelmetricsecho
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const defaultInternerSize = 4096
+
+// internKey identifies the attributes of requests that only carry built-in attributes
+type internKey struct {
+	metric         string
+	service        string
+	route          string
+	method         string
+	originalMethod string
+	scheme         string
+	host           string
+	status         int
+}
+
+// attributeInterner caches attribute sets for MiddlewareConfig.EnableAttributeInterning. Once max sets are
+// cached, sets for new keys are built on every call.
+type attributeInterner struct {
+	mu   sync.RWMutex
+	max  int
+	sets map[internKey]attribute.Set
+}
+
+func newAttributeInterner(max int) *attributeInterner {
+	return &attributeInterner{
+		max:  max,
+		sets: make(map[internKey]attribute.Set),
+	}
+}
+
+func (i *attributeInterner) set(key internKey, build func() attribute.Set) attribute.Set {
+	i.mu.RLock()
+	set, ok := i.sets[key]
+	i.mu.RUnlock()
+	if ok {
+		return set
+	}
+
+	set = build()
+
+	i.mu.Lock()
+	if len(i.sets) < i.max {
+		i.sets[key] = set
+	}
+	i.mu.Unlock()
+
+	return set
+}
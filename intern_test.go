@@ -0,0 +1,104 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestAttributeInterner(t *testing.T) {
+	interner := newAttributeInterner(1)
+	var builds int
+	build := func(route string) func() attribute.Set {
+		return func() attribute.Set {
+			builds++
+			return attribute.NewSet(semconv.HTTPRoute(route))
+		}
+	}
+
+	first := internKey{route: "/first"}
+	for range 2 {
+		set := interner.set(first, build("/first"))
+		if v, _ := set.Value(semconv.HTTPRouteKey); v.AsString() != "/first" {
+			t.Fatalf("set = %v, want /first", set.ToSlice())
+		}
+	}
+	if builds != 1 {
+		t.Fatalf("built %d sets for the same key, want 1", builds)
+	}
+
+	// the interner is full, sets for new keys are built on every call
+	second := internKey{route: "/second"}
+	interner.set(second, build("/second"))
+	interner.set(second, build("/second"))
+	if builds != 3 {
+		t.Fatalf("built %d sets, want 3 once full", builds)
+	}
+}
+
+func TestAttributeInterning(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{EnableAttributeInterning: true})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+	get(e, "/users/2")
+	get(e, "/missing")
+
+	if got, want := routes(t, reader), map[string]int64{"/users/:id": 2, "/missing": 1}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func TestAttributeInterningOverride(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		EnableAttributeInterning: true,
+		AttributesFunc: func(c echo.Context, err error) []attribute.KeyValue {
+			if route := c.Request().Header.Get("X-Route"); route != "" {
+				return []attribute.KeyValue{semconv.HTTPRoute(route)}
+			}
+			return nil
+		},
+	})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+	req := httptest.NewRequest(http.MethodGet, "/users/2", nil)
+	req.Header.Set("X-Route", "/custom")
+	serve(e, req)
+
+	if got, want := routes(t, reader), map[string]int64{"/users/:id": 1, "/custom": 1}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func BenchmarkAttributeInterning(b *testing.B) {
+	for _, interning := range []bool{false, true} {
+		name := "disabled"
+		if interning {
+			name = "enabled"
+		}
+		b.Run(name, func(b *testing.B) {
+			mw, err := MiddlewareConfig{
+				MeterProvider:            noop.NewMeterProvider(),
+				EnableAttributeInterning: interning,
+			}.ToMiddleware()
+			if err != nil {
+				b.Fatal(err)
+			}
+			e := echo.New()
+			e.Use(mw)
+			e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				e.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+// lastRequestTimes holds the unix time of the last request per route for the
+// last_request_timestamp_seconds gauge
+type lastRequestTimes struct {
+	conf  MiddlewareConfig
+	gauge metric.Int64ObservableGauge
+
+	mu    sync.Mutex
+	times map[string]int64
+}
+
+func newLastRequestTimes(conf MiddlewareConfig, gauge metric.Int64ObservableGauge) *lastRequestTimes {
+	return &lastRequestTimes{
+		conf:  conf,
+		gauge: gauge,
+		times: make(map[string]int64),
+	}
+}
+
+func (l *lastRequestTimes) set(route string, unix int64) {
+	l.mu.Lock()
+	l.times[route] = unix
+	l.mu.Unlock()
+}
+
+func (l *lastRequestTimes) observe(_ context.Context, o metric.Observer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for route, unix := range l.times {
+		o.ObserveInt64(l.gauge, unix, l.conf.attributesFor(metricLastRequestTimestamp, []attribute.KeyValue{semconv.HTTPRoute(route)}))
+	}
+
+	return nil
+}
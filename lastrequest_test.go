@@ -0,0 +1,78 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+// lastRequests returns the last_request_timestamp_seconds values by http.route
+func lastRequests(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	t.Helper()
+
+	m, ok := collect(t, reader)[metricLastRequestTimestamp]
+	if !ok {
+		return nil
+	}
+	gauge, ok := m.Data.(metricdata.Gauge[int64])
+	if !ok {
+		t.Fatalf("%s is %T, want metricdata.Gauge[int64]", metricLastRequestTimestamp, m.Data)
+	}
+
+	times := make(map[string]int64)
+	for _, point := range gauge.DataPoints {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		times[route.AsString()] = point.Value
+	}
+
+	return times
+}
+
+func TestLastRequestTimestamp(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mw, shutdown, err := MiddlewareConfig{
+		MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		TimeNow:       fakeClock(time.Second),
+	}.ToMiddlewareWithShutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/first", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/second", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/first")
+	get(e, "/second")
+	get(e, "/unmatched")
+
+	times := lastRequests(t, reader)
+	if len(times) != 2 {
+		t.Fatalf("last_request_timestamp_seconds = %v, want /first and /second only", times)
+	}
+	if times["/first"] == 0 || times["/second"] <= times["/first"] {
+		t.Fatalf("last_request_timestamp_seconds = %v, want /second after /first", times)
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if times := lastRequests(t, reader); len(times) != 0 {
+		t.Fatalf("last_request_timestamp_seconds = %v after shutdown, want none", times)
+	}
+}
+
+func TestLastRequestTimestampDisabled(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{DisableLastRequestTimestamp: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	if times := lastRequests(t, reader); times != nil {
+		t.Fatalf("last_request_timestamp_seconds = %v, want it disabled", times)
+	}
+}
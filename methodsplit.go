@@ -0,0 +1,69 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// splitMethods are the methods getting a request duration histogram of their own with
+// MiddlewareConfig.SeparateHistogramsPerMethod, other methods are recorded as "_OTHER"
+var splitMethods = []string{
+	http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+	http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace, "_OTHER",
+}
+
+// methodHistograms holds a request duration histogram per HTTP method for
+// MiddlewareConfig.SeparateHistogramsPerMethod.
+type methodHistograms struct {
+	histograms map[string]metric.Float64Histogram
+	// names holds the instrument names without namespace, as seen by MetricSkipper and AttributeFilter
+	names map[string]string
+}
+
+// newMethodHistograms creates the histograms of all splitMethods on meter, with the bucket boundaries of
+// conf.DurationBuckets
+func newMethodHistograms(meter metric.Meter, conf MiddlewareConfig) (*methodHistograms, []error) {
+	h := &methodHistograms{
+		histograms: make(map[string]metric.Float64Histogram, len(splitMethods)),
+		names:      make(map[string]string, len(splitMethods)),
+	}
+
+	var errs []error
+	for _, method := range splitMethods {
+		h.names[method] = methodMetricName(conf.DurationUnit.metricName(), methodSuffix(method))
+		name := conf.metricName(h.names[method])
+		histogram, err := meter.Float64Histogram(
+			name,
+			conf.description(name, "The HTTP request latencies of a single HTTP method."),
+			metric.WithExplicitBucketBoundaries(conf.DurationBuckets...),
+			metric.WithUnit(conf.DurationUnit.unit()),
+		)
+		errs = appendInstrumentErr(errs, name, err)
+		h.histograms[method] = histogram
+	}
+
+	return h, errs
+}
+
+func (h *methodHistograms) histogram(method string) metric.Float64Histogram {
+	return h.histograms[normalizeMethod(method)]
+}
+
+// name returns the instrument name of the histogram of method without namespace, e.g.
+// request_duration_get_seconds
+func (h *methodHistograms) name(method string) string {
+	return h.names[normalizeMethod(method)]
+}
+
+// methodSuffix returns the lowercase method used in metric names, e.g. "get" for GET and "other" for _OTHER
+func methodSuffix(method string) string {
+	return strings.ToLower(strings.TrimPrefix(method, "_"))
+}
+
+// methodMetricName inserts method before the unit suffix of name, e.g. request_duration_get_seconds
+func methodMetricName(name, method string) string {
+	i := strings.LastIndex(name, "_")
+	return name[:i] + "_" + method + name[i:]
+}
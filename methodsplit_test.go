@@ -0,0 +1,142 @@
+package otelmetricsecho
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestMethodMetricName(t *testing.T) {
+	tests := map[string]string{
+		"request_duration_seconds":      "request_duration_get_seconds",
+		"api_request_duration_seconds":  "api_request_duration_get_seconds",
+		"request_duration_milliseconds": "request_duration_get_milliseconds",
+	}
+	for name, want := range tests {
+		if got := methodMetricName(name, "get"); got != want {
+			t.Errorf("methodMetricName(%q, get) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSeparateHistogramsPerMethod(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{SeparateHistogramsPerMethod: true})
+	e.Any("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for _, method := range []string{http.MethodGet, http.MethodGet, http.MethodPost, "FOOBAR"} {
+		serve(e, httptest.NewRequest(method, "/", nil))
+	}
+
+	metrics := collect(t, reader)
+	if _, ok := metrics[metricHTTPRequestDurationSeconds]; ok {
+		t.Fatal("shared request_duration_seconds created with SeparateHistogramsPerMethod")
+	}
+	for name, want := range map[string]uint64{
+		"request_duration_get_seconds":   2,
+		"request_duration_post_seconds":  1,
+		"request_duration_other_seconds": 1,
+	} {
+		point := singleHistogram(t, metrics, name)
+		if point.Count != want {
+			t.Errorf("%s count = %d, want %d", name, point.Count, want)
+		}
+		assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/"))
+	}
+	if m, ok := metrics["request_duration_put_seconds"]; ok && len(m.Data.(metricdata.Histogram[float64]).DataPoints) > 0 {
+		t.Fatal("request_duration_put_seconds recorded without PUT requests")
+	}
+}
+
+func TestSeparateHistogramsPerMethodNames(t *testing.T) {
+	var skipped []string
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		SeparateHistogramsPerMethod: true,
+		CardinalityLimit:            2,
+		MetricSkipper: func(_ echo.Context, name string) bool {
+			skipped = append(skipped, name)
+			return name == "request_duration_post_seconds"
+		},
+		AttributeFilter: func(name string, kv attribute.KeyValue) bool {
+			return name != "request_duration_get_seconds" || kv.Key != semconv.HTTPRouteKey
+		},
+	})
+	e.Any("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
+		serve(e, httptest.NewRequest(method, "/", nil))
+	}
+
+	metrics := collect(t, reader)
+	if !slices.Contains(skipped, "request_duration_get_seconds") {
+		t.Errorf("MetricSkipper saw %v, want the per-method histogram names", skipped)
+	}
+	if m, ok := metrics["request_duration_post_seconds"]; ok && len(m.Data.(metricdata.Histogram[float64]).DataPoints) > 0 {
+		t.Error("request_duration_post_seconds recorded although skipped")
+	}
+	assertNoAttr(t, singleHistogram(t, metrics, "request_duration_get_seconds").Attributes, semconv.HTTPRouteKey)
+	// each histogram has a cardinality budget of its own, so PUT is not recorded as overflow
+	put := singleHistogram(t, metrics, "request_duration_put_seconds")
+	assertAttr(t, put.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/"))
+}
+
+// histogramFailingMeter fails to create the histogram called name
+type histogramFailingMeter struct {
+	noop.Meter
+	name string
+}
+
+func (m histogramFailingMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	if name == m.name {
+		return noop.Float64Histogram{}, errInstrument
+	}
+	return noop.Float64Histogram{}, nil
+}
+
+type histogramFailingMeterProvider struct {
+	noop.MeterProvider
+	name string
+}
+
+func (p histogramFailingMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return histogramFailingMeter{name: p.name}
+}
+
+func TestSeparateHistogramsPerMethodErrors(t *testing.T) {
+	const name = "request_duration_patch_seconds"
+	_, err := MiddlewareConfig{
+		MeterProvider:               histogramFailingMeterProvider{name: name},
+		SeparateHistogramsPerMethod: true,
+	}.ToMiddleware()
+	if !errors.Is(err, errInstrument) || !strings.Contains(err.Error(), strconv.Quote(name)) {
+		t.Fatalf("ToMiddleware error = %v, want %q failing", err, name)
+	}
+}
+
+func TestSeparateHistogramsPerMethodPerRoute(t *testing.T) {
+	fastBuckets := []float64{0.001, 0.01}
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		SeparateHistogramsPerMethod: true,
+		PerRoute:                    map[string]RouteConfig{"/fast": {DurationBuckets: fastBuckets}},
+	})
+	e.GET("/fast", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/slow", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/fast")
+	get(e, "/slow")
+
+	points := routeHistogramPoints(t, reader, "request_duration_get_seconds")
+	if got := points["/fast"].Bounds; !slices.Equal(got, fastBuckets) {
+		t.Errorf("/fast bounds = %v, want %v", got, fastBuckets)
+	}
+	if got := points["/slow"].Bounds; !slices.Equal(got, durationBuckets) {
+		t.Errorf("/slow bounds = %v, want %v", got, durationBuckets)
+	}
+}
@@ -1,11 +1,20 @@
 package otelmetricsecho
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
 
@@ -13,6 +22,7 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -24,11 +34,45 @@ const (
 
 const defaultServiceName = "echo"
 const defaultEnv = "production"
+const defaultUnmatchedRouteLabel = "NOT_FOUND"
 const meterName = "otel_metrics_echo"
 
+// statusClientClosedRequest is the non-standard status recorded for requests canceled by the client.
+const statusClientClosedRequest = 499
+
+const (
+	attrHTTPStatusClass = attribute.Key("http.status_class")
+	attrPanic           = attribute.Key("panic")
+	attrQueryPresent    = attribute.Key("http.query.present")
+	attrRequestContent  = attribute.Key("http.request.content_type")
+	attrResponseContent = attribute.Key("http.response.content_type")
+	attrResponseMissing = attribute.Key("response.missing")
+	attrWebSocket       = attribute.Key("websocket")
+	attrTLS             = attribute.Key("tls")
+	attrTLSVersion      = attribute.Key("tls.protocol.version")
+	attrCanceled        = attribute.Key("canceled")
+	attrAPIVersion      = attribute.Key("api.version")
+	attrRouteGroup      = attribute.Key("http.route.group")
+	attrNodeName        = attribute.Key("node.name")
+)
+
 const (
 	metricHTTPRequestsTotal          = "requests_total"
+	metricHTTPRequestsInFlight       = "requests_in_flight"
+	metricHTTPRequestsErrorsTotal    = "requests_errors_total"
+	metricHTTPStreamStartedTotal     = "stream_started_total"
+	metricWebSocketConnectionsTotal  = "websocket_connections_total"
+	metricDroppedTotal               = "metrics_dropped_total"
+	metricLastRequestTimestamp       = "last_request_timestamp_seconds"
+	metricSlowRequestsTotal          = "slow_requests_total"
+	metricSkippedRequestsTotal       = "skipped_requests_total"
+	metricMiddlewareOverhead         = "middleware_overhead_seconds"
+	metricRequestBodyReadSeconds     = "request_body_read_seconds"
+	metricPreflightRequestsTotal     = "preflight_requests_total"
+	metricQueueWaitSeconds           = "queue_wait_seconds"
+	metricSuccessfulRequestsTotal    = "successful_requests_total"
 	metricHTTPRequestDurationSeconds = "request_duration_seconds"
+	metricHTTPRequestDurationMillis  = "request_duration_milliseconds"
 	metricHTTPResponseSizeBytes      = "response_size_bytes"
 	metricHTTPRequestSizeBytes       = "request_size_bytes"
 )
@@ -38,15 +82,349 @@ var sizeBuckets = []float64{1.0 * bKB, 2.0 * bKB, 5.0 * bKB, 10.0 * bKB, 100 * b
 // durationBuckets - bucket in seconds
 var durationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
 
+// durationBucketsMillis - bucket in milliseconds
+var durationBucketsMillis = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// overheadBuckets - bucket in seconds, for the time spent in the middleware itself
+var overheadBuckets = []float64{0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005}
+
+// DefaultDurationBuckets returns the default request duration buckets, in seconds.
+func DefaultDurationBuckets() []float64 {
+	return append([]float64(nil), durationBuckets...)
+}
+
+// LatencyBucketsMillis returns the default request duration buckets, in milliseconds.
+func LatencyBucketsMillis() []float64 {
+	return append([]float64(nil), durationBucketsMillis...)
+}
+
+// SizeBucketsKB returns the default size buckets, in bytes, ranging from 1KB to 10MB.
+func SizeBucketsKB() []float64 {
+	return append([]float64(nil), sizeBuckets...)
+}
+
+// DurationUnit is the unit the request duration histogram is recorded in.
+type DurationUnit int
+
+const (
+	// DurationSeconds records request_duration_seconds in seconds. This is the default.
+	DurationSeconds DurationUnit = iota
+	// DurationMilliseconds records request_duration_milliseconds in milliseconds.
+	DurationMilliseconds
+)
+
+func (u DurationUnit) metricName() string {
+	if u == DurationMilliseconds {
+		return metricHTTPRequestDurationMillis
+	}
+
+	return metricHTTPRequestDurationSeconds
+}
+
+func (u DurationUnit) unit() string {
+	if u == DurationMilliseconds {
+		return "ms"
+	}
+
+	return "s"
+}
+
+func (u DurationUnit) buckets() []float64 {
+	if u == DurationMilliseconds {
+		return durationBucketsMillis
+	}
+
+	return durationBuckets
+}
+
+func (u DurationUnit) value(d time.Duration) float64 {
+	if u == DurationMilliseconds {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	return d.Seconds()
+}
+
 type MiddlewareConfig struct {
-	// Skipper defines a function to skip middleware.
+	// Skipper defines a function to skip middleware. See SkipPaths and SkipExactPaths for common cases.
 	Skipper                   middleware.Skipper
 	ServiceName               string
 	InstanceID                string
 	Env                       string
 	LabelFuncs                map[string]LabelValueFunc
-	timeNow                   func() time.Time
 	DoNotUseRequestPathFor404 bool
+	// MeterProvider is used to create instruments. Defaults to the global provider.
+	MeterProvider metric.MeterProvider
+	// DurationBuckets overrides the bucket boundaries of the request duration histogram.
+	DurationBuckets []float64
+	// RequestSizeBuckets overrides the bucket boundaries of the request size histogram.
+	RequestSizeBuckets []float64
+	// ResponseSizeBuckets overrides the bucket boundaries of the response size histogram.
+	ResponseSizeBuckets []float64
+	// Namespace is prepended with an underscore to every metric name when non-empty.
+	Namespace string
+	// DisableInFlightMetric disables the requests_in_flight up-down counter.
+	DisableInFlightMetric bool
+	// DisableRequestCount disables the requests_total counter.
+	DisableRequestCount bool
+	// DisableDuration disables the request_duration_seconds histogram.
+	DisableDuration bool
+	// DisableRequestSize disables the request_size_bytes histogram.
+	DisableRequestSize bool
+	// DisableResponseSize disables the response_size_bytes histogram.
+	DisableResponseSize bool
+	// StatusClassAttribute adds the http.status_class attribute ("2xx", "4xx", ...) next to the status code.
+	StatusClassAttribute bool
+	// LegacyStatusCodeAttribute additionally emits the deprecated http.status_code attribute.
+	LegacyStatusCodeAttribute bool
+	// UnmatchedRouteLabel is used as the route for requests that did not match any route. Takes precedence
+	// over the raw request path fallback. With DoNotUseRequestPathFor404 it defaults to "NOT_FOUND".
+	UnmatchedRouteLabel string
+	// DisableErrorCount disables the requests_errors_total counter.
+	DisableErrorCount bool
+	// AttributesFunc returns extra attributes for the request. They are appended last, after the built-in
+	// attributes and LabelFuncs.
+	AttributesFunc func(c echo.Context, err error) []attribute.KeyValue
+	// AttributeFilter is consulted for every attribute of every metric. Returning false drops the attribute
+	// from that metric.
+	AttributeFilter func(metricName string, kv attribute.KeyValue) bool
+	// RouteNormalizer rewrites the route before it is recorded as http.route. It is applied after UTF-8
+	// sanitization.
+	RouteNormalizer func(route string) string
+	// DurationUnit is the unit of the request duration histogram. Defaults to DurationSeconds.
+	DurationUnit DurationUnit
+	// MetricSkipper is evaluated per metric and request. Returning true skips recording that metric only.
+	MetricSkipper func(c echo.Context, metricName string) bool
+	// MaxRouteCardinality limits the number of distinct http.route values. Once reached, unseen routes are
+	// recorded as "__overflow__". Zero means no limit.
+	MaxRouteCardinality int
+	// DisablePanicMetric disables recording requests whose handler panicked. By default such requests are
+	// recorded with status 500 and a panic=true attribute before the panic is propagated.
+	DisablePanicMetric bool
+	// LabelKeyPrefix is prepended to every LabelFuncs key.
+	LabelKeyPrefix string
+	// IncludeProtocolVersion adds the network.protocol.version attribute ("1.1", "2", "3").
+	IncludeProtocolVersion bool
+	// MeterName is the instrumentation scope name of the meter. Defaults to "otel_metrics_echo".
+	MeterName string
+	// QueryPresenceAttribute adds the http.query.present attribute telling whether the request URL had a
+	// query string. The query itself is never recorded.
+	QueryPresenceAttribute bool
+	// StreamStartCounter enables the stream_started_total counter, incremented when a request starts being
+	// handled, before the handler runs. Useful for long-running handlers such as Server-Sent Events.
+	StreamStartCounter bool
+	// ContentTypeAttribute adds the http.request.content_type attribute with the request Content-Type reduced
+	// to a small set of values ("json", "form", "multipart", ..., "other").
+	ContentTypeAttribute bool
+	// TimeNow returns the current time used to measure request duration. Defaults to time.Now.
+	TimeNow func() time.Time
+	// ClientIPAttribute adds the client.address attribute from c.RealIP(). The address is passed through
+	// ClientIPFunc, which defaults to recording the /24 network for IPv4 and /48 for IPv6.
+	ClientIPAttribute bool
+	// ClientIPFunc hashes or truncates the client IP before it is recorded.
+	ClientIPFunc func(ip string) string
+	// UseRouteName records the name of the matched route as http.route instead of its path, falling back to
+	// the path when the route has no name. Echo names routes after their handler function unless a name is
+	// set explicitly; such names, e.g. "main.listUsers", are treated as no name.
+	UseRouteName bool
+	// WebSocketHandling controls how WebSocket upgrade requests are recorded. Defaults to WebSocketDefault.
+	WebSocketHandling WebSocketHandling
+	// CountChunkedBody counts the bytes consumed from request bodies of unknown length (ContentLength -1,
+	// e.g. chunked uploads) and adds them to the recorded request size. The body is wrapped transparently.
+	CountChunkedBody bool
+	// MaxAttributeValueLength, when positive, strips control characters from all string attribute values and
+	// truncates values longer than this many runes, marking the cut with an ellipsis.
+	MaxAttributeValueLength int
+	// ClassifyError decides whether a request counts as failed in requests_errors_total. Defaults to
+	// DefaultClassifyError.
+	ClassifyError func(status int, err error) bool
+	// OnObserve is called once per recorded request with the observed values.
+	OnObserve func(Observation)
+	// ServiceVersion adds the service.version attribute when non-empty.
+	ServiceVersion string
+	// ServiceNameFunc returns the service.name attribute for the request. Takes precedence over ServiceName.
+	ServiceNameFunc func(c echo.Context) string
+	// TLSAttribute adds the tls attribute telling whether the request was served over TLS, and the
+	// tls.protocol.version attribute with the negotiated version when it was.
+	TLSAttribute bool
+	// AsyncRecording records measurements on a background goroutine instead of the request goroutine.
+	// Measurements not fitting in the queue are dropped and counted in metrics_dropped_total. Only
+	// ToMiddlewareWithShutdown and NewMiddlewareWithShutdown accept it, their shutdown function drains the
+	// queue and stops the goroutine.
+	AsyncRecording bool
+	// AsyncQueueSize is the capacity of the AsyncRecording queue. Defaults to 1024.
+	AsyncQueueSize int
+	// BaggageKeys lists baggage members of the request context recorded as "baggage.<key>" attributes.
+	// Missing members are skipped.
+	BaggageKeys []string
+	// RequestSizeFunc computes the recorded request size, replacing the built-in approximation from the URL,
+	// method, protocol, headers, host and Content-Length.
+	RequestSizeFunc func(r *http.Request) int64
+	// NormalizeMethod records methods not defined by RFC 9110 or RFC 5789 as "_OTHER" in
+	// http.request.method, keeping the original in http.request.method_original.
+	NormalizeMethod bool
+	// DisableLastRequestTimestamp disables the last_request_timestamp_seconds gauge reporting the time of the
+	// last request per matched route. Its callback stays registered on the meter until the shutdown function
+	// of ToMiddlewareWithShutdown is called.
+	DisableLastRequestTimestamp bool
+	// StaticAttributes are added to every recorded metric, overriding other attributes with the same key.
+	StaticAttributes []attribute.KeyValue
+	// ResponseContentTypeAttribute adds the http.response.content_type attribute with the response
+	// Content-Type reduced like in ContentTypeAttribute.
+	ResponseContentTypeAttribute bool
+	// SlowRequestThreshold enables the slow_requests_total counter, incremented for requests taking longer
+	// than the threshold.
+	SlowRequestThreshold time.Duration
+	// DisableServiceNameAttribute omits the service.name attribute, e.g. when it is already set on the resource.
+	DisableServiceNameAttribute bool
+	// RecordClientDisconnects records requests whose handler returned context.Canceled with status 499
+	// and a canceled=true attribute.
+	RecordClientDisconnects bool
+	// PerRoute overrides the configuration for the routes it contains, keyed by route template as returned
+	// by c.Path(), e.g. `/users/:id`.
+	PerRoute map[string]RouteConfig
+	// HandlerNameAttribute adds the code.function attribute with the name of the handler function serving a
+	// matched route. Without HandlerNames the name is taken from the route name Echo gives by default, so
+	// routes with an explicit name are recorded without code.function.
+	HandlerNameAttribute bool
+	// HandlerNames, created with NewHandlerNames before routes are registered, resolves the handler functions
+	// of routes for HandlerNameAttribute and UseRouteName regardless of their names.
+	HandlerNames *HandlerNames
+	// RouteFromSpan records the http.route attribute of the span in the request context, when set, instead of
+	// the matched route so that metrics line up with traces. Requires a tracing middleware running before
+	// this one and an SDK span exposing its attributes.
+	RouteFromSpan bool
+	// SkipZeroSize skips recording the request and response size histograms for zero sizes, e.g. for 204
+	// responses. By default zero sizes are recorded.
+	SkipZeroSize bool
+	// CountSkipped counts requests skipped by Skipper in skipped_requests_total, partitioned by HTTP method.
+	CountSkipped bool
+	// SizeBucketAdvice sets the bucket boundaries advised for both size histograms, unless overridden by
+	// RequestSizeBuckets or ResponseSizeBuckets. Like all bucket boundaries it is an instrument advice,
+	// used by the default aggregation when no view configures the histogram.
+	SizeBucketAdvice []float64
+	// DefaultUnwrittenStatus is recorded for requests whose handler returned no error without writing a
+	// response, e.g. 0 to tell them apart from written 200 responses. Nil records 200, the status Echo
+	// reports for responses that haven't been written.
+	DefaultUnwrittenStatus *int
+	// BuiltinAttributes selects the built-in attributes recorded with the request metrics. Defaults to
+	// DefaultBuiltinAttributes.
+	BuiltinAttributes BuiltinAttributes
+	// SizeSampleRate records the size histograms for the given fraction of requests, between 0 (never) and
+	// 1 (always). Nil records every request.
+	SizeSampleRate *float64
+	// SizeSampleRand returns the random numbers in [0, 1) compared to SizeSampleRate. It must be safe for
+	// concurrent use. Defaults to math/rand/v2.Float64.
+	SizeSampleRand func() float64
+	// APIVersionFromAccept adds the api.version attribute with the version found in the Accept header, e.g.
+	// "v2" for "application/vnd.myapp.v2+json" or "application/json; version=2", and "unknown" otherwise.
+	APIVersionFromAccept bool
+	// APIVersionFunc returns the api.version attribute for the request, replacing the Accept header parsing
+	// of APIVersionFromAccept. Empty values are recorded as "unknown".
+	APIVersionFunc func(c echo.Context) string
+	// MeasureOverhead enables the middleware_overhead_seconds histogram with the time spent computing
+	// attributes and recording once the handler returned.
+	MeasureOverhead bool
+	// GRPCStatusAttribute adds the rpc.grpc.status_code attribute with the status sent in the grpc-status
+	// response header or trailer, e.g. by gRPC-Web or gRPC-Gateway handlers. The HTTP status is unchanged.
+	GRPCStatusAttribute bool
+	// SeparateHistogramsPerMethod records request durations in one histogram per HTTP method, named with the
+	// lowercase method before the unit, e.g. request_duration_get_seconds, instead of the shared histogram,
+	// which is then not created. Methods not defined by RFC 9110 or RFC 5789 share
+	// request_duration_other_seconds.
+	SeparateHistogramsPerMethod bool
+	// ContextKeys lists Echo context values, as set with c.Set, recorded as "ctx.<key>" attributes. Values are
+	// formatted with fmt.Sprint; nil values are skipped.
+	ContextKeys []string
+	// MeasureBodyReadTime enables the request_body_read_seconds histogram with the time the handler spent
+	// reading the request body. Requests whose body was not read are not recorded.
+	MeasureBodyReadTime bool
+	// Descriptions overrides instrument descriptions, keyed by metric name including the Namespace prefix.
+	Descriptions map[string]string
+	// HandleError calls the Echo error handler when the handler returns an error, so that the status it writes
+	// is recorded instead of one derived from the error. Like middleware.RequestLoggerConfig.HandleError, the
+	// response is committed afterwards and the error is still returned.
+	HandleError bool
+	// ServerPortAttribute adds the server.port attribute with the port from the Host header, falling back to the
+	// port of the listener that accepted the request and then to the default port of the scheme.
+	ServerPortAttribute bool
+	// EnableAttributeInterning caches the attribute sets of requests carrying only built-in attributes, keyed
+	// by route, method, status and the other built-in values, saving an allocation per recorded metric. The
+	// cache holds up to 4096 sets; other combinations are built per request.
+	EnableAttributeInterning bool
+	// CountResponseBytes wraps the response writer to count the bytes written, including writes to the
+	// underlying http.ResponseWriter bypassing Echo, and records the larger of this count and Echo's.
+	CountResponseBytes bool
+	// RecordPredicate reports whether all metrics are recorded for the request. When it returns false only
+	// requests_total is recorded.
+	RecordPredicate func(c echo.Context, err error) bool
+	// RouteGroupAttribute adds the http.route.group attribute with the group prefix of the matched route,
+	// e.g. "/api/v1" for "/api/v1/users/:id".
+	RouteGroupAttribute bool
+	// RouteGroupFunc returns the http.route.group attribute for the request, replacing the prefix derived by
+	// RouteGroupAttribute. Empty values are not recorded.
+	RouteGroupFunc func(c echo.Context) string
+	// CompatibilityMode matches the names of the echo-contrib Prometheus middleware for dashboards migrating
+	// from it: Namespace defaults to "http", e.g. http_requests_total, server.address is recorded by default
+	// and the status code, method, route and host attributes are recorded as code, method, url and host.
+	CompatibilityMode bool
+	// SeparatePreflightMetrics counts OPTIONS requests, such as CORS preflight requests, in
+	// preflight_requests_total and excludes them from the request duration histogram.
+	SeparatePreflightMetrics bool
+	// ErrorTypeAttribute adds the error.type attribute with the type name of the error returned by the handler,
+	// e.g. "*echo.HTTPError", for a small set of well-known types and "other" for the rest.
+	ErrorTypeAttribute bool
+	// ErrorTypeFunc returns the error.type attribute for errors returned by the handler, replacing the type
+	// names of ErrorTypeAttribute. Empty values are not recorded.
+	ErrorTypeFunc func(err error) string
+	// QueueWaitHeader names a header carrying the time a load balancer received the request, such as
+	// X-Request-Start, and enables the queue_wait_seconds histogram with the time until the middleware
+	// started. Missing, malformed and future timestamps are skipped, as are waits above an hour.
+	QueueWaitHeader string
+	// DetailedErrorsOnly records the request metrics only for responses with a status of 400 or above.
+	// Other requests are only counted in successful_requests_total, partitioned by HTTP method and route.
+	DetailedErrorsOnly bool
+	// NodeName adds the node.name attribute when non-empty.
+	NodeName string
+	// UseHostnameAsNode defaults NodeName to the hostname.
+	UseHostnameAsNode bool
+	// RecordWithBackgroundContext records with a context detached from the request cancellation, so requests
+	// that complete after the client disconnected are still recorded. Context values such as the active span
+	// are kept for exemplars.
+	RecordWithBackgroundContext bool
+	// RecordTimeout bounds the context used for recording when RecordWithBackgroundContext is set. Zero means
+	// no timeout.
+	RecordTimeout time.Duration
+	// CardinalityLimit bounds the distinct attribute sets recorded per metric, including the overflow set.
+	// Once reached, measurements with new attribute sets are recorded with the single attribute
+	// otel.metric.overflow=true, as the OTel SDK does for its own limit. Zero means no limit. The limit is
+	// tracked per middleware: middlewares sharing a MeterProvider record into the same instruments, so
+	// together they can record up to CardinalityLimit sets each.
+	CardinalityLimit int
+
+	// cardinality is created by build from CardinalityLimit
+	cardinality *attributeSetLimiter
+}
+
+// Observation holds the values observed for a single request.
+type Observation struct {
+	Route        string
+	Method       string
+	Status       int
+	Duration     time.Duration
+	RequestSize  int64
+	ResponseSize int64
+	// Attributes are the attributes recorded with the request metrics, before AttributeFilter is applied.
+	Attributes []attribute.KeyValue
+}
+
+// Instruments holds the instruments created by the middleware. Disabled instruments are nil, as is
+// RequestDuration with SeparateHistogramsPerMethod.
+type Instruments struct {
+	RequestCount    metric.Int64Counter
+	RequestDuration metric.Float64Histogram
+	RequestSize     metric.Float64Histogram
+	ResponseSize    metric.Float64Histogram
 }
 
 type LabelValueFunc func(c echo.Context, err error) string
@@ -66,17 +444,122 @@ func NewMiddlewareWithConfig(config MiddlewareConfig) echo.MiddlewareFunc {
 	return mw
 }
 
+// NewMiddlewareWithShutdown is like NewMiddlewareWithConfig but also returns the shutdown function of
+// ToMiddlewareWithShutdown.
+func NewMiddlewareWithShutdown(config MiddlewareConfig) (echo.MiddlewareFunc, func(context.Context) error) {
+	mw, shutdown, err := config.ToMiddlewareWithShutdown()
+	if err != nil {
+		panic(err)
+	}
+
+	return mw, shutdown
+}
+
+// errAsyncWithoutShutdown is returned by the constructors that cannot stop the AsyncRecording goroutine
+var errAsyncWithoutShutdown = errors.New("otelmetricsecho: AsyncRecording requires ToMiddlewareWithShutdown or NewMiddlewareWithShutdown")
+
 func (conf MiddlewareConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
-	if conf.timeNow == nil {
-		conf.timeNow = time.Now
+	if conf.AsyncRecording {
+		return nil, errAsyncWithoutShutdown
+	}
+
+	mw, _, _, err := conf.build()
+	return mw, err
+}
+
+// ToMiddlewareWithInstruments is like ToMiddleware but also returns the created instruments so they can be
+// used for custom recording.
+func (conf MiddlewareConfig) ToMiddlewareWithInstruments() (echo.MiddlewareFunc, Instruments, error) {
+	if conf.AsyncRecording {
+		return nil, Instruments{}, errAsyncWithoutShutdown
+	}
+
+	mw, instruments, _, err := conf.build()
+	return mw, instruments, err
+}
+
+// ToMiddlewareWithShutdown is like ToMiddleware but also returns a function stopping background work of
+// the middleware. It unregisters the last_request_timestamp_seconds callback and, with AsyncRecording,
+// waits until queued measurements are recorded or ctx is done. It is safe to call more than once.
+func (conf MiddlewareConfig) ToMiddlewareWithShutdown() (echo.MiddlewareFunc, func(context.Context) error, error) {
+	mw, _, shutdown, err := conf.build()
+	return mw, shutdown, err
+}
+
+func (conf MiddlewareConfig) build() (echo.MiddlewareFunc, Instruments, func(context.Context) error, error) {
+	if conf.TimeNow == nil {
+		conf.TimeNow = time.Now
 	}
 
 	if conf.Env == "" {
 		conf.Env = defaultEnv
 	}
 
-	if conf.ServiceName == "" {
-		conf.ServiceName = defaultServiceName
+	conf.ServiceName = conf.serviceName()
+
+	if conf.BuiltinAttributes == 0 {
+		conf.BuiltinAttributes = DefaultBuiltinAttributes
+		if conf.CompatibilityMode {
+			conf.BuiltinAttributes |= BuiltinHost
+		}
+	}
+
+	if conf.CompatibilityMode && conf.Namespace == "" {
+		conf.Namespace = compatibilityNamespace
+	}
+
+	if len(conf.DurationBuckets) == 0 {
+		conf.DurationBuckets = conf.DurationUnit.buckets()
+	}
+
+	if len(conf.SizeBucketAdvice) == 0 {
+		conf.SizeBucketAdvice = sizeBuckets
+	}
+
+	if len(conf.RequestSizeBuckets) == 0 {
+		conf.RequestSizeBuckets = conf.SizeBucketAdvice
+	}
+
+	if len(conf.ResponseSizeBuckets) == 0 {
+		conf.ResponseSizeBuckets = conf.SizeBucketAdvice
+	}
+
+	bucketErrs := []error{
+		validateBuckets(conf.DurationUnit.metricName(), conf.DurationBuckets),
+		validateBuckets(metricHTTPRequestSizeBytes, conf.RequestSizeBuckets),
+		validateBuckets(metricHTTPResponseSizeBytes, conf.ResponseSizeBuckets),
+	}
+	for route, routeConf := range conf.PerRoute {
+		bucketErrs = append(bucketErrs,
+			validateBuckets(route+" "+conf.DurationUnit.metricName(), routeConf.DurationBuckets),
+			validateBuckets(route+" "+metricHTTPRequestSizeBytes, routeConf.RequestSizeBuckets),
+			validateBuckets(route+" "+metricHTTPResponseSizeBytes, routeConf.ResponseSizeBuckets),
+		)
+	}
+	if err := errors.Join(bucketErrs...); err != nil {
+		return nil, Instruments{}, nil, err
+	}
+
+	if conf.SizeSampleRate != nil {
+		rate := *conf.SizeSampleRate
+		if rate < 0 || rate > 1 {
+			return nil, Instruments{}, nil, fmt.Errorf("otelmetricsecho: SizeSampleRate must be between 0 and 1, got %v", rate)
+		}
+		conf.SizeSampleRate = &rate
+	}
+
+	if conf.SizeSampleRand == nil {
+		conf.SizeSampleRand = rand.Float64
+	}
+
+	conf.StaticAttributes = dedupAttributes(slices.Clone(conf.StaticAttributes))
+
+	if conf.ClassifyError == nil {
+		conf.ClassifyError = DefaultClassifyError
+	}
+
+	if conf.ClientIPFunc == nil {
+		conf.ClientIPFunc = truncateClientIP
 	}
 
 	if conf.InstanceID == "" {
@@ -88,97 +571,1039 @@ func (conf MiddlewareConfig) ToMiddleware() (echo.MiddlewareFunc, error) {
 		conf.InstanceID = instanceID
 	}
 
-	var meterProvider = otel.GetMeterProvider()
-	metrics := meterProvider.Meter(
-		meterName,
-		metric.WithInstrumentationAttributes(
-			semconv.ServiceName(conf.ServiceName),
-			semconv.ServiceInstanceID(conf.InstanceID),
-		),
-	)
+	if conf.CardinalityLimit > 0 {
+		conf.cardinality = newAttributeSetLimiter(conf.CardinalityLimit)
+	}
 
-	requestCount, _ := metrics.Int64Counter(
-		metricHTTPRequestsTotal,
-		metric.WithDescription("How many HTTP requests processed, partitioned by status code and HTTP method."),
-	)
+	if conf.NodeName == "" && conf.UseHostnameAsNode {
+		if hostname, err := os.Hostname(); err == nil {
+			conf.NodeName = hostname
+		}
+	}
 
-	requestDuration, _ := metrics.Float64Histogram(
-		metricHTTPRequestDurationSeconds,
-		metric.WithDescription("The HTTP request latencies in seconds."),
-		metric.WithExplicitBucketBoundaries(durationBuckets...),
-		metric.WithUnit("seconds"),
-	)
+	meterProvider := conf.MeterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
 
-	responseSize, _ := metrics.Float64Histogram(
-		metricHTTPResponseSizeBytes,
-		metric.WithDescription("The HTTP response sizes in bytes."),
-		metric.WithExplicitBucketBoundaries(sizeBuckets...),
-		metric.WithUnit("bytes"),
-	)
+	if conf.MeterName == "" {
+		conf.MeterName = meterName
+	}
 
-	requestSize, _ := metrics.Float64Histogram(
-		metricHTTPRequestSizeBytes,
-		metric.WithDescription("The HTTP request sizes in bytes."),
-		metric.WithExplicitBucketBoundaries(sizeBuckets...),
-		metric.WithUnit("bytes"),
+	// service name and instance are recorded as attributes only, so that the SDK hands out the same meter
+	// and instruments to all middlewares using the same provider and meter name
+	metrics := meterProvider.Meter(conf.MeterName, metric.WithInstrumentationVersion(Version))
+
+	var (
+		err  error
+		errs []error
 	)
 
+	var requestCount metric.Int64Counter
+	if !conf.DisableRequestCount {
+		requestCount, err = metrics.Int64Counter(
+			conf.metricName(metricHTTPRequestsTotal),
+			conf.description(conf.metricName(metricHTTPRequestsTotal), "How many HTTP requests processed, partitioned by status code and HTTP method."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPRequestsTotal), err)
+	}
+
+	// with SeparateHistogramsPerMethod durations are only recorded in the per-method histograms
+	var requestDuration metric.Float64Histogram
+	if !conf.DisableDuration && !conf.SeparateHistogramsPerMethod {
+		requestDuration, err = metrics.Float64Histogram(
+			conf.metricName(conf.DurationUnit.metricName()),
+			conf.description(conf.metricName(conf.DurationUnit.metricName()), "The HTTP request latencies."),
+			metric.WithExplicitBucketBoundaries(conf.DurationBuckets...),
+			metric.WithUnit(conf.DurationUnit.unit()),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(conf.DurationUnit.metricName()), err)
+	}
+
+	var responseSize metric.Float64Histogram
+	if !conf.DisableResponseSize {
+		responseSize, err = metrics.Float64Histogram(
+			conf.metricName(metricHTTPResponseSizeBytes),
+			conf.description(conf.metricName(metricHTTPResponseSizeBytes), "The HTTP response sizes in bytes."),
+			metric.WithExplicitBucketBoundaries(conf.ResponseSizeBuckets...),
+			metric.WithUnit("By"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPResponseSizeBytes), err)
+	}
+
+	var requestSize metric.Float64Histogram
+	if !conf.DisableRequestSize {
+		requestSize, err = metrics.Float64Histogram(
+			conf.metricName(metricHTTPRequestSizeBytes),
+			conf.description(conf.metricName(metricHTTPRequestSizeBytes), "The HTTP request sizes in bytes."),
+			metric.WithExplicitBucketBoundaries(conf.RequestSizeBuckets...),
+			metric.WithUnit("By"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPRequestSizeBytes), err)
+	}
+
+	var requestsInFlight metric.Int64UpDownCounter
+	if !conf.DisableInFlightMetric {
+		requestsInFlight, err = metrics.Int64UpDownCounter(
+			conf.metricName(metricHTTPRequestsInFlight),
+			conf.description(conf.metricName(metricHTTPRequestsInFlight), "How many HTTP requests are currently being processed."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPRequestsInFlight), err)
+	}
+
+	var requestErrors metric.Int64Counter
+	if !conf.DisableErrorCount {
+		requestErrors, err = metrics.Int64Counter(
+			conf.metricName(metricHTTPRequestsErrorsTotal),
+			conf.description(conf.metricName(metricHTTPRequestsErrorsTotal), "How many HTTP requests failed with an error or a 5xx status, partitioned by status code, HTTP method and route."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPRequestsErrorsTotal), err)
+	}
+
+	var streamStarted metric.Int64Counter
+	if conf.StreamStartCounter {
+		streamStarted, err = metrics.Int64Counter(
+			conf.metricName(metricHTTPStreamStartedTotal),
+			conf.description(conf.metricName(metricHTTPStreamStartedTotal), "How many HTTP requests started being processed, partitioned by HTTP method and route."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPStreamStartedTotal), err)
+	}
+
+	var webSocketConnections metric.Int64Counter
+	if conf.WebSocketHandling == WebSocketSeparate {
+		webSocketConnections, err = metrics.Int64Counter(
+			conf.metricName(metricWebSocketConnectionsTotal),
+			conf.description(conf.metricName(metricWebSocketConnectionsTotal), "How many WebSocket upgrade requests processed, partitioned by status code and route."),
+			metric.WithUnit("{connection}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricWebSocketConnectionsTotal), err)
+	}
+
+	var queueWait metric.Float64Histogram
+	if conf.QueueWaitHeader != "" {
+		queueWait, err = metrics.Float64Histogram(
+			conf.metricName(metricQueueWaitSeconds),
+			conf.description(conf.metricName(metricQueueWaitSeconds), "How long HTTP requests waited between the load balancer and the server, partitioned by HTTP method and route."),
+			metric.WithExplicitBucketBoundaries(durationBuckets...),
+			metric.WithUnit("s"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricQueueWaitSeconds), err)
+	}
+
+	var successfulRequests metric.Int64Counter
+	if conf.DetailedErrorsOnly {
+		successfulRequests, err = metrics.Int64Counter(
+			conf.metricName(metricSuccessfulRequestsTotal),
+			conf.description(conf.metricName(metricSuccessfulRequestsTotal), "How many HTTP requests completed with a status below 400, partitioned by HTTP method and route."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricSuccessfulRequestsTotal), err)
+	}
+
+	var preflightRequests metric.Int64Counter
+	if conf.SeparatePreflightMetrics {
+		preflightRequests, err = metrics.Int64Counter(
+			conf.metricName(metricPreflightRequestsTotal),
+			conf.description(conf.metricName(metricPreflightRequestsTotal), "How many OPTIONS requests processed, partitioned by status code and route."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricPreflightRequestsTotal), err)
+	}
+
+	var dropped metric.Int64Counter
+	if conf.AsyncRecording {
+		dropped, err = metrics.Int64Counter(
+			conf.metricName(metricDroppedTotal),
+			conf.description(conf.metricName(metricDroppedTotal), "How many measurements were dropped because the async recording queue was full."),
+			metric.WithUnit("{measurement}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricDroppedTotal), err)
+	}
+
+	var overhead metric.Float64Histogram
+	if conf.MeasureOverhead {
+		overhead, err = metrics.Float64Histogram(
+			conf.metricName(metricMiddlewareOverhead),
+			conf.description(conf.metricName(metricMiddlewareOverhead), "How long it took to record the metrics of an HTTP request once the handler returned, partitioned by HTTP method and route."),
+			metric.WithUnit("s"),
+			metric.WithExplicitBucketBoundaries(overheadBuckets...),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricMiddlewareOverhead), err)
+	}
+
+	var perMethod *methodHistograms
+	if !conf.DisableDuration && conf.SeparateHistogramsPerMethod {
+		var methodErrs []error
+		perMethod, methodErrs = newMethodHistograms(metrics, conf)
+		errs = append(errs, methodErrs...)
+	}
+
+	defaultHistograms := routeHistograms{
+		duration:     requestDuration,
+		perMethod:    perMethod,
+		requestSize:  requestSize,
+		responseSize: responseSize,
+	}
+	perRouteHistograms := make(map[string]routeHistograms)
+	for route, routeConf := range conf.PerRoute {
+		if routeConf.overridesBuckets() {
+			var routeErrs []error
+			perRouteHistograms[route], routeErrs = newRouteHistograms(meterProvider, conf, route, routeConf, defaultHistograms)
+			errs = append(errs, routeErrs...)
+		}
+	}
+
+	var bodyReadTime metric.Float64Histogram
+	if conf.MeasureBodyReadTime {
+		bodyReadTime, err = metrics.Float64Histogram(
+			conf.metricName(metricRequestBodyReadSeconds),
+			conf.description(conf.metricName(metricRequestBodyReadSeconds), "How long reading the HTTP request body took, partitioned by HTTP method and route."),
+			metric.WithExplicitBucketBoundaries(durationBuckets...),
+			metric.WithUnit("s"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricRequestBodyReadSeconds), err)
+	}
+
+	var slowRequests metric.Int64Counter
+	if conf.SlowRequestThreshold > 0 {
+		slowRequests, err = metrics.Int64Counter(
+			conf.metricName(metricSlowRequestsTotal),
+			conf.description(conf.metricName(metricSlowRequestsTotal), "How many HTTP requests took longer than the slow request threshold, partitioned by HTTP method and route."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricSlowRequestsTotal), err)
+	}
+
+	var skippedRequests metric.Int64Counter
+	if conf.CountSkipped {
+		skippedRequests, err = metrics.Int64Counter(
+			conf.metricName(metricSkippedRequestsTotal),
+			conf.description(conf.metricName(metricSkippedRequestsTotal), "How many HTTP requests were skipped by the skipper, partitioned by HTTP method."),
+			metric.WithUnit("{request}"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricSkippedRequestsTotal), err)
+	}
+
+	var lastRequests *lastRequestTimes
+	var registration metric.Registration
+	if !conf.DisableLastRequestTimestamp {
+		var gauge metric.Int64ObservableGauge
+		gauge, err = metrics.Int64ObservableGauge(
+			conf.metricName(metricLastRequestTimestamp),
+			conf.description(conf.metricName(metricLastRequestTimestamp), "Unix time of the last HTTP request, partitioned by route."),
+			metric.WithUnit("s"),
+		)
+		if err == nil {
+			lastRequests = newLastRequestTimes(conf, gauge)
+			registration, err = metrics.RegisterCallback(lastRequests.observe, gauge)
+		}
+		errs = appendInstrumentErr(errs, conf.metricName(metricLastRequestTimestamp), err)
+	}
+
+	if len(errs) > 0 {
+		if registration != nil {
+			_ = registration.Unregister()
+		}
+		return nil, Instruments{}, nil, errors.Join(errs...)
+	}
+
+	var async *asyncRecorder
+	if conf.AsyncRecording {
+		if conf.AsyncQueueSize <= 0 {
+			conf.AsyncQueueSize = defaultAsyncQueueSize
+		}
+		async = newAsyncRecorder(conf.AsyncQueueSize, dropped, conf.attributesFor(metricDroppedTotal, nil))
+	}
+
+	var unregister sync.Once
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		unregister.Do(func() {
+			if registration != nil {
+				errs = append(errs, registration.Unregister())
+			}
+		})
+		if async != nil {
+			errs = append(errs, async.shutdown(ctx))
+		}
+
+		return errors.Join(errs...)
+	}
+
+	instruments := Instruments{
+		RequestCount:    requestCount,
+		RequestDuration: requestDuration,
+		RequestSize:     requestSize,
+		ResponseSize:    responseSize,
+	}
+
+	var interner *attributeInterner
+	if conf.EnableAttributeInterning {
+		interner = newAttributeInterner(defaultInternerSize)
+	}
+
+	var names *routeNames
+	if conf.UseRouteName || conf.HandlerNameAttribute {
+		names = &routeNames{handlers: conf.HandlerNames}
+	}
+
+	var routes *routeLimiter
+	if conf.MaxRouteCardinality > 0 {
+		routes = newRouteLimiter(conf.MaxRouteCardinality)
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if conf.Skipper != nil && conf.Skipper(c) {
+				if skippedRequests != nil && !conf.skipMetric(c, metricSkippedRequestsTotal) {
+					method := c.Request().Method
+					if conf.NormalizeMethod {
+						method = normalizeMethod(method)
+					}
+					skippedRequests.Add(c.Request().Context(), 1, conf.attributesFor(metricSkippedRequestsTotal, []attribute.KeyValue{
+						semconv.HTTPRequestMethodKey.String(method),
+					}))
+				}
 				return next(c)
 			}
 
-			reqSz := computeApproximateRequestSize(c.Request())
+			var reqSz int64
+			if conf.RequestSizeFunc != nil {
+				reqSz = conf.RequestSizeFunc(c.Request())
+			} else {
+				reqSz = int64(computeApproximateRequestSize(c.Request()))
+			}
 
-			start := conf.timeNow()
-			err := next(c)
-			elapsed := conf.timeNow().Sub(start).Seconds()
+			var body *countingReadCloser
+			if conf.CountChunkedBody && c.Request().ContentLength == -1 && c.Request().Body != nil {
+				body = &countingReadCloser{ReadCloser: c.Request().Body}
+				c.Request().Body = body
+			}
+
+			var written *countingResponseWriter
+			if conf.CountResponseBytes && c.Response() != nil {
+				written = &countingResponseWriter{ResponseWriter: c.Response().Writer}
+				c.Response().Writer = written
+			}
 
-			url := c.Path() // contains route path ala `/users/:id`
-			if url == "" && !conf.DoNotUseRequestPathFor404 {
-				// as of Echo v4.10.1 path is empty for 404 cases (when router did not find any matching routes)
-				// in this case we use actual path from request to have some distinction in Prometheus
-				url = c.Request().URL.Path
+			var timedBody *timingReadCloser
+			if bodyReadTime != nil && c.Request().Body != nil && c.Request().Body != http.NoBody {
+				timedBody = &timingReadCloser{ReadCloser: c.Request().Body, now: conf.TimeNow}
+				c.Request().Body = timedBody
 			}
 
-			status := c.Response().Status
-			if err != nil {
-				var httpError *echo.HTTPError
-				if errors.As(err, &httpError) {
-					status = httpError.Code
+			// contains route path ala `/users/:id`. Wildcard routes such as `/static/*` (and `/group/*` for
+			// unmatched paths inside a group with middlewares) are kept as-is, so they stay low-cardinality
+			// regardless of the actual requested path.
+			url := c.Path()
+			if url != "" && conf.UseRouteName {
+				if name := names.routeName(c); name != "" {
+					url = name
 				}
-				if status == 0 || status == http.StatusOK {
-					status = http.StatusInternalServerError
+			}
+			if conf.RouteFromSpan {
+				if route := spanRoute(c.Request().Context()); route != "" {
+					url = route
 				}
 			}
+			if url == "" {
+				if conf.UnmatchedRouteLabel != "" {
+					url = conf.UnmatchedRouteLabel
+				} else if conf.DoNotUseRequestPathFor404 {
+					url = defaultUnmatchedRouteLabel
+				} else {
+					// as of Echo v4.10.1 path is empty for 404 cases (when router did not find any matching routes)
+					// in this case we use actual path from request to have some distinction in Prometheus
+					url = c.Request().URL.Path
+				}
+			}
+			route := strings.ToValidUTF8(url, "\uFFFD")
+			if conf.RouteNormalizer != nil {
+				route = conf.RouteNormalizer(route)
+			}
+			if routes != nil {
+				route = routes.route(route)
+			}
+
+			routeConf := conf.PerRoute[c.Path()]
+			histograms, ok := perRouteHistograms[c.Path()]
+			if !ok {
+				histograms = defaultHistograms
+			}
+
+			method := c.Request().Method
+			if conf.NormalizeMethod {
+				method = normalizeMethod(method)
+			}
+
+			if requestsInFlight != nil && !conf.skipMetric(c, metricHTTPRequestsInFlight) {
+				inFlightAttributes := conf.attributesFor(metricHTTPRequestsInFlight, []attribute.KeyValue{
+					semconv.HTTPRoute(route),
+					semconv.HTTPRequestMethodKey.String(method),
+				})
+				requestsInFlight.Add(c.Request().Context(), 1, inFlightAttributes)
+				defer func() {
+					ctx, cancel := conf.recordContext(c.Request().Context())
+					defer cancel()
+					requestsInFlight.Add(ctx, -1, inFlightAttributes)
+				}()
+			}
+
+			if streamStarted != nil && !conf.skipMetric(c, metricHTTPStreamStartedTotal) {
+				streamStarted.Add(c.Request().Context(), 1, conf.attributesFor(metricHTTPStreamStartedTotal, []attribute.KeyValue{
+					semconv.HTTPRoute(route),
+					semconv.HTTPRequestMethodKey.String(method),
+				}))
+			}
+
+			webSocket := isWebSocketUpgrade(c.Request())
 
-			var attrs []attribute.KeyValue
-			attrs = append(attrs, semconv.ServiceName(conf.ServiceName))
-			attrs = append(attrs, semconv.ServiceInstanceID(conf.InstanceID))
-			attrs = append(attrs, semconv.DeploymentEnvironment(conf.Env))
-			attrs = append(attrs, semconv.HTTPRoute(strings.ToValidUTF8(url, "\uFFFD")))
-			attrs = append(attrs, semconv.HTTPRequestMethodKey.String(c.Request().Method))
-			attrs = append(attrs, semconv.URLScheme(c.Scheme()))
-			attrs = append(attrs, semconv.HostName(c.Request().Host))
-			attrs = append(attrs, semconv.HTTPResponseStatusCode(status))
+			start := conf.TimeNow()
 
-			for key, labelFunc := range conf.LabelFuncs {
-				attrs = append(attrs, attribute.String(key, labelFunc(c, err)))
+			if queueWait != nil && !conf.skipMetric(c, metricQueueWaitSeconds) {
+				received, ok := parseRequestStart(c.Request().Header.Get(conf.QueueWaitHeader))
+				if wait := start.Sub(received); ok && wait >= 0 && wait <= maxQueueWait {
+					queueWait.Record(c.Request().Context(), wait.Seconds(), conf.attributesFor(metricQueueWaitSeconds, []attribute.KeyValue{
+						semconv.HTTPRoute(route),
+						semconv.HTTPRequestMethodKey.String(method),
+					}))
+				}
 			}
+			observe := func(err error, panicked bool) {
+				duration := conf.TimeNow().Sub(start)
+
+				resp := c.Response()
+				status := 0
+				if resp != nil {
+					status = resp.Status
+				}
+				canceled := conf.RecordClientDisconnects && !panicked && errors.Is(err, context.Canceled)
+				if panicked {
+					status = http.StatusInternalServerError
+				} else if canceled {
+					status = statusClientClosedRequest
+				} else if err != nil && (resp == nil || !resp.Committed) {
+					// once the response is committed the client has already seen its status, possibly written by
+					// an error handling middleware downstream, so the error must not override it
+					var httpError *echo.HTTPError
+					if errors.As(err, &httpError) {
+						status = httpError.Code
+					}
+					if status == 0 || status == http.StatusOK {
+						status = http.StatusInternalServerError
+					}
+				} else if err == nil && conf.DefaultUnwrittenStatus != nil && resp != nil && !resp.Committed {
+					status = *conf.DefaultUnwrittenStatus
+				}
+
+				var attrs []attribute.KeyValue
+				var key internKey
+				if conf.BuiltinAttributes.has(BuiltinService) {
+					if !conf.DisableServiceNameAttribute {
+						key.service = conf.ServiceName
+						if conf.ServiceNameFunc != nil {
+							key.service = conf.ServiceNameFunc(c)
+						}
+						attrs = append(attrs, semconv.ServiceName(key.service))
+					}
+					attrs = append(attrs, semconv.ServiceInstanceID(conf.InstanceID))
+					if conf.ServiceVersion != "" {
+						attrs = append(attrs, semconv.ServiceVersion(conf.ServiceVersion))
+					}
+					attrs = append(attrs, semconv.DeploymentEnvironment(conf.Env))
+				}
+				if conf.BuiltinAttributes.has(BuiltinRoute) {
+					key.route = route
+					attrs = append(attrs, semconv.HTTPRoute(route))
+				}
+				if conf.BuiltinAttributes.has(BuiltinMethod) {
+					key.method = method
+					attrs = append(attrs, semconv.HTTPRequestMethodKey.String(method))
+					if method != c.Request().Method {
+						key.originalMethod = c.Request().Method
+						attrs = append(attrs, semconv.HTTPRequestMethodOriginal(c.Request().Method))
+					}
+				}
+				if conf.BuiltinAttributes.has(BuiltinScheme) {
+					// c.Scheme honours X-Forwarded-Proto and similar headers set by proxies.
+					key.scheme = c.Scheme()
+					attrs = append(attrs, semconv.URLScheme(key.scheme))
+				}
+				if conf.BuiltinAttributes.has(BuiltinHost) {
+					key.host = serverAddress(c.Request().Host)
+					attrs = append(attrs, semconv.ServerAddress(key.host))
+				}
+				if conf.BuiltinAttributes.has(BuiltinStatus) {
+					key.status = status
+					attrs = append(attrs, semconv.HTTPResponseStatusCode(status))
+				}
+				if conf.NodeName != "" {
+					attrs = append(attrs, attrNodeName.String(conf.NodeName))
+				}
+				// the attributes so far only depend on the interning key and the configuration
+				builtins := len(attrs)
+				if conf.QueryPresenceAttribute {
+					attrs = append(attrs, attrQueryPresent.Bool(c.Request().URL.RawQuery != ""))
+				}
+				if conf.ContentTypeAttribute {
+					attrs = append(attrs, attrRequestContent.String(normalizeContentType(c.Request().Header.Get(echo.HeaderContentType))))
+				}
+				if conf.ResponseContentTypeAttribute {
+					contentType := ""
+					if resp != nil {
+						contentType = resp.Header().Get(echo.HeaderContentType)
+					}
+					attrs = append(attrs, attrResponseContent.String(normalizeContentType(contentType)))
+				}
+				if conf.ClientIPAttribute {
+					attrs = append(attrs, semconv.ClientAddress(conf.ClientIPFunc(c.RealIP())))
+				}
+				if conf.ServerPortAttribute {
+					attrs = append(attrs, semconv.ServerPort(serverPort(c.Request(), c.Scheme())))
+				}
+				if conf.TLSAttribute {
+					state := c.Request().TLS
+					attrs = append(attrs, attrTLS.Bool(state != nil))
+					if state != nil {
+						if version := tlsProtocolVersion(state.Version); version != "" {
+							attrs = append(attrs, attrTLSVersion.String(version))
+						}
+					}
+				}
+				if conf.IncludeProtocolVersion {
+					if version := protocolVersion(c.Request().Proto); version != "" {
+						attrs = append(attrs, semconv.NetworkProtocolVersion(version))
+					}
+				}
+				if conf.RouteGroupFunc != nil {
+					if group := conf.RouteGroupFunc(c); group != "" {
+						attrs = append(attrs, attrRouteGroup.String(group))
+					}
+				} else if conf.RouteGroupAttribute && c.Path() != "" {
+					attrs = append(attrs, attrRouteGroup.String(routeGroup(c.Path())))
+				}
+				if err != nil && (conf.ErrorTypeAttribute || conf.ErrorTypeFunc != nil) {
+					var errType string
+					if conf.ErrorTypeFunc != nil {
+						errType = conf.ErrorTypeFunc(err)
+					} else {
+						errType = errorType(err)
+					}
+					if errType != "" {
+						attrs = append(attrs, semconv.ErrorTypeKey.String(errType))
+					}
+				}
+				if conf.GRPCStatusAttribute && resp != nil {
+					if code, ok := grpcStatus(resp.Header()); ok {
+						attrs = append(attrs, semconv.RPCGRPCStatusCodeKey.Int(code))
+					}
+				}
+				if conf.APIVersionFunc != nil {
+					version := conf.APIVersionFunc(c)
+					if version == "" {
+						version = apiVersionUnknown
+					}
+					attrs = append(attrs, attrAPIVersion.String(version))
+				} else if conf.APIVersionFromAccept {
+					attrs = append(attrs, attrAPIVersion.String(apiVersionFromAccept(c.Request().Header.Get(echo.HeaderAccept))))
+				}
+				if conf.HandlerNameAttribute && c.Path() != "" {
+					if name := names.handlerName(c); name != "" {
+						attrs = append(attrs, semconv.CodeFunction(name))
+					}
+				}
+				if conf.LegacyStatusCodeAttribute {
+					attrs = append(attrs, semconv.HTTPStatusCodeKey.Int(status))
+				}
+				if conf.StatusClassAttribute {
+					attrs = append(attrs, attrHTTPStatusClass.String(statusClass(status)))
+				}
+
+				if len(conf.BaggageKeys) > 0 {
+					bag := baggage.FromContext(c.Request().Context())
+					for _, key := range conf.BaggageKeys {
+						if member := bag.Member(key); member.Key() != "" {
+							attrs = append(attrs, attribute.String("baggage."+key, member.Value()))
+						}
+					}
+				}
+
+				for _, key := range conf.ContextKeys {
+					if value := c.Get(key); value != nil {
+						attrs = append(attrs, attribute.String("ctx."+key, fmt.Sprint(value)))
+					}
+				}
+
+				for key, labelFunc := range conf.LabelFuncs {
+					attrs = append(attrs, attribute.String(conf.LabelKeyPrefix+key, labelFunc(c, err)))
+				}
+
+				if conf.AttributesFunc != nil {
+					attrs = append(attrs, conf.AttributesFunc(c, err)...)
+				}
+
+				attrs = append(attrs, routeConf.Attributes...)
+
+				if panicked {
+					attrs = append(attrs, attrPanic.Bool(true))
+				}
+				if canceled {
+					attrs = append(attrs, attrCanceled.Bool(true))
+				}
+				if resp == nil {
+					attrs = append(attrs, attrResponseMissing.Bool(true))
+				}
+				if webSocket && conf.WebSocketHandling == WebSocketAttribute {
+					attrs = append(attrs, attrWebSocket.Bool(true))
+				}
+				// appended once for all request metrics, last so that they override any other attribute
+				attrs = append(attrs, conf.StaticAttributes...)
+				// decided before dedup, an attribute overriding a built-in one must keep the request from being
+				// interned as it changes the set without changing the interning key
+				interned := interner != nil && len(attrs) == builtins+len(conf.StaticAttributes)
+				attrs = dedupAttributes(attrs)
+
+				reqSize := reqSz
+				if body != nil {
+					reqSize += body.n
+				}
+				respSize := computeResponseSize(resp)
+				if written != nil && written.n > respSize {
+					respSize = written.n
+				}
+
+				if conf.OnObserve != nil {
+					conf.OnObserve(Observation{
+						Route:        route,
+						Method:       method,
+						Status:       status,
+						Duration:     duration,
+						RequestSize:  reqSize,
+						ResponseSize: respSize,
+						Attributes:   attrs,
+					})
+				}
+
+				// request is read after next so that spans started by downstream middlewares end up in exemplars
+				ctx := c.Request().Context()
+
+				// only matched routes are tracked to keep the set bounded
+				if lastRequests != nil && c.Path() != "" && !conf.skipMetric(c, metricLastRequestTimestamp) {
+					lastRequests.set(route, conf.TimeNow().Unix())
+				}
+
+				// which metrics to record is decided here as c must not be used once the request is done
+				detailed := !conf.DetailedErrorsOnly || status >= http.StatusBadRequest
+				recordSuccess := successfulRequests != nil && !detailed &&
+					!conf.skipMetric(c, metricSuccessfulRequestsTotal)
+				recordCount := requestCount != nil && detailed && !routeConf.DisableRequestCount &&
+					!conf.skipMetric(c, metricHTTPRequestsTotal)
+				full := detailed && (conf.RecordPredicate == nil || conf.RecordPredicate(c, err))
+				sampleSize := full && (conf.SizeSampleRate == nil || conf.SizeSampleRand() < *conf.SizeSampleRate)
+				recordRequestSize := histograms.requestSize != nil && sampleSize && !routeConf.DisableRequestSize &&
+					!(conf.SkipZeroSize && reqSize == 0) && !conf.skipMetric(c, metricHTTPRequestSizeBytes)
+				recordResponseSize := histograms.responseSize != nil && sampleSize && !routeConf.DisableResponseSize &&
+					!(conf.SkipZeroSize && respSize == 0) && !conf.skipMetric(c, metricHTTPResponseSizeBytes)
+				preflight := conf.SeparatePreflightMetrics && c.Request().Method == http.MethodOptions
+				durationName := conf.DurationUnit.metricName()
+				if histograms.perMethod != nil {
+					durationName = histograms.perMethod.name(method)
+				}
+				recordDuration := (histograms.duration != nil || histograms.perMethod != nil) && full && !routeConf.DisableDuration && !preflight &&
+					!(webSocket && conf.WebSocketHandling == WebSocketSeparate) &&
+					!conf.skipMetric(c, durationName)
+				recordError := requestErrors != nil && full && conf.ClassifyError(status, err) &&
+					!conf.skipMetric(c, metricHTTPRequestsErrorsTotal)
+				recordWebSocket := webSocketConnections != nil && full && webSocket &&
+					!conf.skipMetric(c, metricWebSocketConnectionsTotal)
+				recordPreflight := preflightRequests != nil && full && preflight &&
+					!conf.skipMetric(c, metricPreflightRequestsTotal)
+				recordBodyReadTime := timedBody != nil && full && timedBody.reads > 0 &&
+					!conf.skipMetric(c, metricRequestBodyReadSeconds)
+				var bodyRead time.Duration
+				if recordBodyReadTime {
+					bodyRead = timedBody.d
+				}
+				recordSlow := slowRequests != nil && full && duration > conf.SlowRequestThreshold &&
+					!conf.skipMetric(c, metricSlowRequestsTotal)
+
+				requestAttributes := func(name string) metric.MeasurementOption {
+					if !interned {
+						return conf.measurementOption(name, attrs)
+					}
+
+					key := key
+					key.metric = name
+					return metric.WithAttributeSet(conf.limitedSet(name, interner.set(key, func() attribute.Set {
+						return conf.attributeSetFor(name, attrs)
+					})))
+				}
+
+				if conf.RecordWithBackgroundContext {
+					ctx = context.WithoutCancel(ctx)
+				}
 
-			attributes := metric.WithAttributes(attrs...)
+				record := func() {
+					ctx, cancel := conf.recordContext(ctx)
+					defer cancel()
 
-			ctx := c.Request().Context()
+					if recordSuccess {
+						successfulRequests.Add(ctx, 1, conf.attributesFor(metricSuccessfulRequestsTotal, []attribute.KeyValue{
+							semconv.HTTPRoute(route),
+							semconv.HTTPRequestMethodKey.String(method),
+						}))
+					}
+					if recordCount {
+						requestCount.Add(ctx, 1, requestAttributes(metricHTTPRequestsTotal))
+					}
+					if recordRequestSize {
+						histograms.requestSize.Record(ctx, float64(reqSize), requestAttributes(metricHTTPRequestSizeBytes))
+					}
+					if recordResponseSize {
+						histograms.responseSize.Record(ctx, float64(respSize), requestAttributes(metricHTTPResponseSizeBytes))
+					}
+					if recordDuration {
+						if histograms.perMethod != nil {
+							histograms.perMethod.histogram(method).Record(ctx, conf.DurationUnit.value(duration), requestAttributes(durationName))
+						} else {
+							histograms.duration.Record(ctx, conf.DurationUnit.value(duration), requestAttributes(durationName))
+						}
+					}
+					if recordError {
+						requestErrors.Add(ctx, 1, conf.attributesFor(metricHTTPRequestsErrorsTotal, []attribute.KeyValue{
+							semconv.HTTPRoute(route),
+							semconv.HTTPRequestMethodKey.String(method),
+							semconv.HTTPResponseStatusCode(status),
+						}))
+					}
+					if recordWebSocket {
+						webSocketConnections.Add(ctx, 1, conf.attributesFor(metricWebSocketConnectionsTotal, []attribute.KeyValue{
+							semconv.HTTPRoute(route),
+							semconv.HTTPResponseStatusCode(status),
+						}))
+					}
+					if recordPreflight {
+						preflightRequests.Add(ctx, 1, conf.attributesFor(metricPreflightRequestsTotal, []attribute.KeyValue{
+							semconv.HTTPRoute(route),
+							semconv.HTTPResponseStatusCode(status),
+						}))
+					}
+					if recordBodyReadTime {
+						bodyReadTime.Record(ctx, bodyRead.Seconds(), conf.attributesFor(metricRequestBodyReadSeconds, []attribute.KeyValue{
+							semconv.HTTPRoute(route),
+							semconv.HTTPRequestMethodKey.String(method),
+						}))
+					}
+					if recordSlow {
+						slowRequests.Add(ctx, 1, conf.attributesFor(metricSlowRequestsTotal, []attribute.KeyValue{
+							semconv.HTTPRoute(route),
+							semconv.HTTPRequestMethodKey.String(method),
+						}))
+					}
+				}
 
-			requestCount.Add(ctx, 1, attributes)
-			requestSize.Record(ctx, float64(reqSz), attributes)
-			responseSize.Record(ctx, float64(c.Response().Size), attributes)
-			requestDuration.Record(ctx, elapsed, attributes)
+				if async != nil {
+					async.push(ctx, record)
+				} else {
+					record()
+				}
+			}
+
+			if !conf.DisablePanicMetric {
+				defer func() {
+					if r := recover(); r != nil {
+						observe(nil, true)
+						panic(r)
+					}
+				}()
+			}
+
+			err := next(c)
+			if err != nil && conf.HandleError {
+				c.Error(err)
+			}
+			if overhead != nil && !conf.skipMetric(c, metricMiddlewareOverhead) {
+				overheadStart := conf.TimeNow()
+				observe(err, false)
+				ctx, cancel := conf.recordContext(c.Request().Context())
+				overhead.Record(ctx, conf.TimeNow().Sub(overheadStart).Seconds(), conf.attributesFor(metricMiddlewareOverhead, []attribute.KeyValue{
+					semconv.HTTPRoute(route),
+					semconv.HTTPRequestMethodKey.String(method),
+				}))
+				cancel()
+			} else {
+				observe(err, false)
+			}
 
 			return err
 		}
-	}, nil
+	}, instruments, shutdown, nil
+}
+
+// recordContext returns the context to record measurements taken after the handler returned with, detached
+// from the request cancellation and bounded by RecordTimeout when RecordWithBackgroundContext is set
+func (conf MiddlewareConfig) recordContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if !conf.RecordWithBackgroundContext {
+		return ctx, func() {}
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if conf.RecordTimeout > 0 {
+		return context.WithTimeout(ctx, conf.RecordTimeout)
+	}
+
+	return ctx, func() {}
+}
+
+// DefaultClassifyError treats 5xx statuses and errors other than *echo.HTTPError as failures. HTTP errors
+// with a 4xx code are not counted.
+func DefaultClassifyError(status int, err error) bool {
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+
+	var httpError *echo.HTTPError
+	return err != nil && !errors.As(err, &httpError)
+}
+
+// serviceName returns ServiceName, falling back to the OTEL_SERVICE_NAME environment variable and then to "echo"
+func (conf MiddlewareConfig) serviceName() string {
+	if conf.ServiceName != "" {
+		return conf.ServiceName
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+
+	return defaultServiceName
+}
+
+func (conf MiddlewareConfig) metricName(name string) string {
+	if conf.Namespace == "" {
+		return name
+	}
+
+	return conf.Namespace + "_" + name
+}
+
+// description returns the description of the named instrument, from Descriptions or the given default
+func (conf MiddlewareConfig) description(name, description string) metric.InstrumentOption {
+	if override, ok := conf.Descriptions[name]; ok {
+		description = override
+	}
+
+	return metric.WithDescription(description)
+}
+
+func (conf MiddlewareConfig) skipMetric(c echo.Context, name string) bool {
+	return conf.MetricSkipper != nil && conf.MetricSkipper(c, conf.metricName(name))
+}
+
+// attributesFor adds StaticAttributes to attrs and applies AttributeFilter and MaxAttributeValueLength for
+// the given metric
+func (conf MiddlewareConfig) attributesFor(name string, attrs []attribute.KeyValue) metric.MeasurementOption {
+	return conf.measurementOption(name, append(attrs[:len(attrs):len(attrs)], conf.StaticAttributes...))
+}
+
+// measurementOption is like attributesFor for attrs already containing StaticAttributes
+func (conf MiddlewareConfig) measurementOption(name string, attrs []attribute.KeyValue) metric.MeasurementOption {
+	if conf.cardinality != nil {
+		return metric.WithAttributeSet(conf.limitedSet(name, conf.attributeSetFor(name, attrs)))
+	}
+
+	return metric.WithAttributes(conf.measurementAttributes(name, attrs)...)
+}
+
+// limitedSet applies CardinalityLimit to the attribute set recorded for metric name
+func (conf MiddlewareConfig) limitedSet(name string, set attribute.Set) attribute.Set {
+	if conf.cardinality == nil {
+		return set
+	}
+
+	return conf.cardinality.set(name, set)
+}
+
+// attributeSetFor is like measurementOption but returns the attribute set
+func (conf MiddlewareConfig) attributeSetFor(name string, attrs []attribute.KeyValue) attribute.Set {
+	// NewSet sorts its argument in place
+	return attribute.NewSet(slices.Clone(conf.measurementAttributes(name, attrs))...)
+}
+
+// measurementAttributes returns attrs with AttributeFilter and MaxAttributeValueLength applied. The
+// returned slice may be attrs itself.
+func (conf MiddlewareConfig) measurementAttributes(name string, attrs []attribute.KeyValue) []attribute.KeyValue {
+	if conf.AttributeFilter == nil && conf.MaxAttributeValueLength <= 0 && !conf.CompatibilityMode {
+		return attrs
+	}
+
+	name = conf.metricName(name)
+	filtered := make([]attribute.KeyValue, 0, len(attrs))
+	for _, kv := range attrs {
+		if conf.AttributeFilter != nil && !conf.AttributeFilter(name, kv) {
+			continue
+		}
+		if conf.MaxAttributeValueLength > 0 && kv.Value.Type() == attribute.STRING {
+			kv = kv.Key.String(sanitizeAttributeValue(kv.Value.AsString(), conf.MaxAttributeValueLength))
+		}
+		filtered = append(filtered, kv)
+	}
+	if conf.CompatibilityMode {
+		filtered = compatibilityAttributes(filtered)
+	}
+
+	return filtered
+}
+
+// dedupAttributes keeps a single attribute per key. Later attributes override earlier ones in place, so
+// attributes from LabelFuncs, AttributesFunc and PerRoute replace built-in attributes with the same key.
+func dedupAttributes(attrs []attribute.KeyValue) []attribute.KeyValue {
+	index := make(map[attribute.Key]int, len(attrs))
+	deduped := attrs[:0]
+	for _, kv := range attrs {
+		if i, ok := index[kv.Key]; ok {
+			deduped[i] = kv
+			continue
+		}
+		index[kv.Key] = len(deduped)
+		deduped = append(deduped, kv)
+	}
+
+	return deduped
+}
+
+// sanitizeAttributeValue strips control characters from value and truncates it to maxLen runes, replacing
+// the last rune with an ellipsis when truncated
+func sanitizeAttributeValue(value string, maxLen int) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+
+	if utf8.RuneCountInString(value) <= maxLen {
+		return value
+	}
+
+	runes := []rune(value)
+
+	return string(runes[:maxLen-1]) + "…"
+}
+
+func validateBuckets(name string, buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("otelmetricsecho: %q buckets must be strictly ascending, got %v", name, buckets)
+		}
+	}
+
+	return nil
+}
+
+func appendInstrumentErr(errs []error, name string, err error) []error {
+	if err != nil {
+		errs = append(errs, fmt.Errorf("otelmetricsecho: failed to create %q instrument: %w", name, err))
+	}
+
+	return errs
+}
+
+// statusClass returns the status class of the code, e.g. "2xx" for 204
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// normalizeMethod returns method if it is a known HTTP method, "_OTHER" otherwise. Methods are case-sensitive.
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+		http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace:
+		return method
+	}
+
+	return semconv.HTTPRequestMethodOther.Value.AsString()
+}
+
+// protocolVersion returns version part of HTTP protocol as used by semconv, e.g. "1.1" for "HTTP/1.1" and "2"
+// for "HTTP/2.0". Returns empty string when proto is not HTTP.
+func protocolVersion(proto string) string {
+	version, ok := strings.CutPrefix(proto, "HTTP/")
+	if !ok {
+		return ""
+	}
+
+	switch version {
+	case "2.0":
+		return "2"
+	case "3.0":
+		return "3"
+	}
+
+	return version
+}
+
+// serverAddress returns host without the port part and without the brackets around IPv6 addresses
+func serverAddress(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// no port, e.g. "example.com" or "[::1]"
+		if len(hostport) > 1 && hostport[0] == '[' && hostport[len(hostport)-1] == ']' {
+			return hostport[1 : len(hostport)-1]
+		}
+		return hostport
+	}
+
+	return host
+}
+
+// serverPort returns the port of the Host header of r, the port of the listener that accepted r, or the
+// default port of scheme
+func serverPort(r *http.Request, scheme string) int {
+	if port, ok := portOf(r.Host); ok {
+		return port
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		if port, ok := portOf(addr.String()); ok {
+			return port
+		}
+	}
+	if scheme == "https" {
+		return 443
+	}
+
+	return 80
+}
+
+func portOf(hostport string) (int, bool) {
+	_, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return 0, false
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+
+	return p, true
+}
+
+// computeResponseSize returns the number of bytes written through Echo's response writer, or the
+// Content-Length response header when it is larger, e.g. for bodies written bypassing Echo's writer.
+func computeResponseSize(r *echo.Response) int64 {
+	if r == nil {
+		return 0
+	}
+
+	size := r.Size
+	if cl, err := strconv.ParseInt(r.Header().Get(echo.HeaderContentLength), 10, 64); err == nil && cl > size {
+		size = cl
+	}
+
+	return size
 }
 
 func computeApproximateRequestSize(r *http.Request) int {
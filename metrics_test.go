@@ -0,0 +1,2103 @@
+package otelmetricsecho
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestEcho returns an Echo instance using the middleware configured with conf, recording into a
+// MeterProvider read by the returned reader
+func newTestEcho(t *testing.T, conf MiddlewareConfig) (*echo.Echo, *sdkmetric.ManualReader) {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	conf.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	mw, err := conf.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(mw)
+
+	return e, reader
+}
+
+func serve(e *echo.Echo, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func get(e *echo.Echo, target string) *httptest.ResponseRecorder {
+	return serve(e, httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+// collect returns the metrics collected by reader keyed by name
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := make(map[string]metricdata.Metrics)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+
+	return metrics
+}
+
+func sumPoints(t *testing.T, metrics map[string]metricdata.Metrics, name string) []metricdata.DataPoint[int64] {
+	t.Helper()
+
+	m, ok := metrics[name]
+	if !ok {
+		t.Fatalf("metric %q not recorded", name)
+	}
+	sum, ok := m.Data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("metric %q is %T, want metricdata.Sum[int64]", name, m.Data)
+	}
+
+	return sum.DataPoints
+}
+
+func histogramPoints(t *testing.T, metrics map[string]metricdata.Metrics, name string) []metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+
+	m, ok := metrics[name]
+	if !ok {
+		t.Fatalf("metric %q not recorded", name)
+	}
+	histogram, ok := m.Data.(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("metric %q is %T, want metricdata.Histogram[float64]", name, m.Data)
+	}
+
+	return histogram.DataPoints
+}
+
+// singleSum returns the only data point of the named counter
+func singleSum(t *testing.T, metrics map[string]metricdata.Metrics, name string) metricdata.DataPoint[int64] {
+	t.Helper()
+
+	points := sumPoints(t, metrics, name)
+	if len(points) != 1 {
+		t.Fatalf("metric %q has %d data points, want 1", name, len(points))
+	}
+
+	return points[0]
+}
+
+// singleHistogram returns the only data point of the named histogram
+func singleHistogram(t *testing.T, metrics map[string]metricdata.Metrics, name string) metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+
+	points := histogramPoints(t, metrics, name)
+	if len(points) != 1 {
+		t.Fatalf("metric %q has %d data points, want 1", name, len(points))
+	}
+
+	return points[0]
+}
+
+// assertAttr fails unless attrs has key with want as emitted value
+func assertAttr(t *testing.T, attrs attribute.Set, key attribute.Key, want attribute.Value) {
+	t.Helper()
+
+	got, ok := attrs.Value(key)
+	if !ok {
+		t.Fatalf("attribute %q missing from %v", key, attrs.ToSlice())
+	}
+	if got != want {
+		t.Fatalf("attribute %q = %v, want %v", key, got.Emit(), want.Emit())
+	}
+}
+
+// assertNoAttr fails when attrs has key
+func assertNoAttr(t *testing.T, attrs attribute.Set, key attribute.Key) {
+	t.Helper()
+
+	if got, ok := attrs.Value(key); ok {
+		t.Fatalf("attribute %q = %v, want none", key, got.Emit())
+	}
+}
+
+func TestMeterProvider(t *testing.T) {
+	global := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(global)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	first, firstReader := newTestEcho(t, MiddlewareConfig{ServiceName: "first"})
+	first.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	second, secondReader := newTestEcho(t, MiddlewareConfig{ServiceName: "second"})
+	second.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	get(first, "/")
+	get(second, "/")
+	get(second, "/")
+
+	point := singleSum(t, collect(t, firstReader), metricHTTPRequestsTotal)
+	if point.Value != 1 {
+		t.Fatalf("first requests_total = %d, want 1", point.Value)
+	}
+	assertAttr(t, point.Attributes, semconv.ServiceNameKey, attribute.StringValue("first"))
+
+	point = singleSum(t, collect(t, secondReader), metricHTTPRequestsTotal)
+	if point.Value != 2 {
+		t.Fatalf("second requests_total = %d, want 2", point.Value)
+	}
+	assertAttr(t, point.Attributes, semconv.ServiceNameKey, attribute.StringValue("second"))
+
+	if metrics := collect(t, global); len(metrics) != 0 {
+		t.Fatalf("global provider recorded %d metrics, want none", len(metrics))
+	}
+}
+
+func TestGlobalMeterProvider(t *testing.T) {
+	global := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(global)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	e := echo.New()
+	e.Use(NewMiddleware("myapp"))
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	point := singleSum(t, collect(t, global), metricHTTPRequestsTotal)
+	assertAttr(t, point.Attributes, semconv.ServiceNameKey, attribute.StringValue("myapp"))
+}
+
+// failingMeterProvider returns meters failing to create counters
+type failingMeterProvider struct {
+	noop.MeterProvider
+}
+
+func (failingMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return failingMeter{}
+}
+
+type failingMeter struct {
+	noop.Meter
+}
+
+var errInstrument = errors.New("instrument failed")
+
+func (failingMeter) Int64Counter(string, ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return noop.Int64Counter{}, errInstrument
+}
+
+func TestInstrumentErrors(t *testing.T) {
+	_, err := MiddlewareConfig{MeterProvider: failingMeterProvider{}}.ToMiddleware()
+	if !errors.Is(err, errInstrument) {
+		t.Fatalf("ToMiddleware error = %v, want %v", err, errInstrument)
+	}
+	for _, name := range []string{metricHTTPRequestsTotal, metricHTTPRequestsErrorsTotal} {
+		if !strings.Contains(err.Error(), strconv.Quote(name)) {
+			t.Errorf("ToMiddleware error %q does not name %q", err, name)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewMiddlewareWithConfig did not panic")
+		}
+	}()
+	NewMiddlewareWithConfig(MiddlewareConfig{MeterProvider: failingMeterProvider{}})
+}
+
+func TestDurationBuckets(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	point := singleHistogram(t, collect(t, reader), metricHTTPRequestDurationSeconds)
+	if !slices.Equal(point.Bounds, durationBuckets) {
+		t.Fatalf("default bounds = %v, want %v", point.Bounds, durationBuckets)
+	}
+
+	buckets := []float64{0.1, 0.5, 1}
+	e, reader = newTestEcho(t, MiddlewareConfig{DurationBuckets: buckets})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	point = singleHistogram(t, collect(t, reader), metricHTTPRequestDurationSeconds)
+	if !slices.Equal(point.Bounds, buckets) {
+		t.Fatalf("bounds = %v, want %v", point.Bounds, buckets)
+	}
+}
+
+func TestDurationBucketsInvalid(t *testing.T) {
+	for _, buckets := range [][]float64{{1, 0.5}, {0.1, 0.1}} {
+		if _, err := (MiddlewareConfig{MeterProvider: noop.NewMeterProvider(), DurationBuckets: buckets}).ToMiddleware(); err == nil {
+			t.Errorf("ToMiddleware with buckets %v succeeded, want error", buckets)
+		}
+	}
+}
+
+func TestSizeBuckets(t *testing.T) {
+	requestBuckets := []float64{100, 1000}
+	responseBuckets := []float64{10, 20, 30}
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		RequestSizeBuckets:  requestBuckets,
+		ResponseSizeBuckets: responseBuckets,
+	})
+	e.GET("/", func(c echo.Context) error { return c.String(http.StatusOK, "hello") })
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	if got := singleHistogram(t, metrics, metricHTTPRequestSizeBytes).Bounds; !slices.Equal(got, requestBuckets) {
+		t.Errorf("request size bounds = %v, want %v", got, requestBuckets)
+	}
+	if got := singleHistogram(t, metrics, metricHTTPResponseSizeBytes).Bounds; !slices.Equal(got, responseBuckets) {
+		t.Errorf("response size bounds = %v, want %v", got, responseBuckets)
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{ResponseSizeBuckets: responseBuckets})
+	e.GET("/", func(c echo.Context) error { return c.String(http.StatusOK, "hello") })
+	get(e, "/")
+
+	metrics = collect(t, reader)
+	if got := singleHistogram(t, metrics, metricHTTPRequestSizeBytes).Bounds; !slices.Equal(got, sizeBuckets) {
+		t.Errorf("default request size bounds = %v, want %v", got, sizeBuckets)
+	}
+	if got := singleHistogram(t, metrics, metricHTTPResponseSizeBytes).Bounds; !slices.Equal(got, responseBuckets) {
+		t.Errorf("response size bounds = %v, want %v", got, responseBuckets)
+	}
+}
+
+func TestSizeBucketsInvalid(t *testing.T) {
+	for _, conf := range []MiddlewareConfig{
+		{RequestSizeBuckets: []float64{10, 1}},
+		{ResponseSizeBuckets: []float64{10, 10}},
+	} {
+		conf.MeterProvider = noop.NewMeterProvider()
+		if _, err := conf.ToMiddleware(); err == nil {
+			t.Errorf("ToMiddleware with %+v succeeded, want error", conf)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{Namespace: "myapp"})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	for _, name := range []string{
+		metricHTTPRequestsTotal,
+		metricHTTPRequestDurationSeconds,
+		metricHTTPRequestSizeBytes,
+		metricHTTPResponseSizeBytes,
+		metricHTTPRequestsInFlight,
+	} {
+		if _, ok := metrics["myapp_"+name]; !ok {
+			t.Errorf("metric %q not recorded", "myapp_"+name)
+		}
+		if _, ok := metrics[name]; ok {
+			t.Errorf("metric %q recorded without namespace", name)
+		}
+	}
+}
+
+func TestServerAddress(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{BuiltinAttributes: DefaultBuiltinAttributes | BuiltinHost})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "https://example.com:8443/", nil)
+	serve(e, req)
+
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.ServerAddressKey, attribute.StringValue("example.com"))
+	assertAttr(t, attrs, semconv.URLSchemeKey, attribute.StringValue("https"))
+	assertNoAttr(t, attrs, semconv.HostNameKey)
+}
+
+func TestRequestsInFlight(t *testing.T) {
+	const n = 5
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	var started sync.WaitGroup
+	started.Add(n)
+	release := make(chan struct{})
+	e.GET("/users/:id", func(c echo.Context) error {
+		started.Done()
+		<-release
+		return c.NoContent(http.StatusOK)
+	})
+
+	var done sync.WaitGroup
+	for i := range n {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			get(e, fmt.Sprintf("/users/%d", i))
+		}()
+	}
+	started.Wait()
+
+	if during := singleSum(t, collect(t, reader), metricHTTPRequestsInFlight).Value; during != n {
+		t.Fatalf("requests_in_flight while %d requests are blocked = %d, want %d", n, during, n)
+	}
+	close(release)
+	done.Wait()
+
+	point := singleSum(t, collect(t, reader), metricHTTPRequestsInFlight)
+	if point.Value != 0 {
+		t.Fatalf("requests_in_flight after requests = %d, want 0", point.Value)
+	}
+	assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/users/:id"))
+	assertAttr(t, point.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+}
+
+func TestDisableMetrics(t *testing.T) {
+	tests := []struct {
+		conf   MiddlewareConfig
+		metric string
+	}{
+		{MiddlewareConfig{DisableRequestCount: true}, metricHTTPRequestsTotal},
+		{MiddlewareConfig{DisableDuration: true}, metricHTTPRequestDurationSeconds},
+		{MiddlewareConfig{DisableRequestSize: true}, metricHTTPRequestSizeBytes},
+		{MiddlewareConfig{DisableResponseSize: true}, metricHTTPResponseSizeBytes},
+		{MiddlewareConfig{DisableInFlightMetric: true}, metricHTTPRequestsInFlight},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric, func(t *testing.T) {
+			e, reader := newTestEcho(t, tt.conf)
+			e.GET("/", func(c echo.Context) error { return c.String(http.StatusOK, "hello") })
+			get(e, "/")
+
+			metrics := collect(t, reader)
+			if _, ok := metrics[tt.metric]; ok {
+				t.Fatalf("disabled metric %q recorded", tt.metric)
+			}
+			for _, other := range tests {
+				if _, ok := metrics[other.metric]; !ok && other.metric != tt.metric {
+					t.Errorf("metric %q not recorded", other.metric)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusClassAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{StatusClassAttribute: true})
+	e.GET("/:status", func(c echo.Context) error {
+		status, _ := strconv.Atoi(c.Param("status"))
+		return c.NoContent(status)
+	})
+	for _, status := range []string{"200", "204", "302", "404", "503"} {
+		get(e, "/"+status)
+	}
+
+	classes := make(map[int64]string)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		status, _ := point.Attributes.Value(semconv.HTTPResponseStatusCodeKey)
+		class, _ := point.Attributes.Value(attrHTTPStatusClass)
+		classes[status.AsInt64()] = class.AsString()
+	}
+	want := map[int64]string{200: "2xx", 204: "2xx", 302: "3xx", 404: "4xx", 503: "5xx"}
+	if !maps.Equal(classes, want) {
+		t.Fatalf("status classes = %v, want %v", classes, want)
+	}
+}
+
+func TestStatusClassAttributeDisabled(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	assertNoAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, attrHTTPStatusClass)
+}
+
+func TestLegacyStatusCodeAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusAccepted) })
+	get(e, "/")
+
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusAccepted))
+	assertNoAttr(t, attrs, semconv.HTTPStatusCodeKey)
+
+	e, reader = newTestEcho(t, MiddlewareConfig{LegacyStatusCodeAttribute: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusAccepted) })
+	get(e, "/")
+
+	attrs = singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusAccepted))
+	assertAttr(t, attrs, semconv.HTTPStatusCodeKey, attribute.IntValue(http.StatusAccepted))
+}
+
+// routes returns the recorded requests_total values by http.route
+func routes(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	t.Helper()
+
+	counts := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		counts[route.AsString()] += point.Value
+	}
+
+	return counts
+}
+
+func TestUnmatchedRoute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+	get(e, "/missing")
+
+	if got, want := routes(t, reader), map[string]int64{"/users/:id": 1, "/missing": 1}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{UnmatchedRouteLabel: "unmatched"})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+	get(e, "/missing")
+	get(e, "/other")
+
+	if got, want := routes(t, reader), map[string]int64{"/users/:id": 1, "unmatched": 2}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/ok", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/fail", func(c echo.Context) error { return errors.New("boom") })
+	e.GET("/unavailable", func(c echo.Context) error { return c.NoContent(http.StatusServiceUnavailable) })
+	get(e, "/ok")
+	get(e, "/fail")
+	get(e, "/fail")
+	get(e, "/unavailable")
+
+	statuses := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsErrorsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		status, _ := point.Attributes.Value(semconv.HTTPResponseStatusCodeKey)
+		assertAttr(t, point.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+		statuses[route.AsString()+" "+status.Emit()] = point.Value
+	}
+	if want := map[string]int64{"/fail 500": 2, "/unavailable 503": 1}; !maps.Equal(statuses, want) {
+		t.Fatalf("requests_errors_total = %v, want %v", statuses, want)
+	}
+}
+
+func TestDisableErrorCount(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{DisableErrorCount: true})
+	e.GET("/fail", func(c echo.Context) error { return errors.New("boom") })
+	get(e, "/fail")
+
+	if _, ok := collect(t, reader)[metricHTTPRequestsErrorsTotal]; ok {
+		t.Fatal("requests_errors_total recorded although disabled")
+	}
+}
+
+// requestMetrics are the metrics recorded with the request attributes by default
+var requestMetrics = []string{
+	metricHTTPRequestsTotal,
+	metricHTTPRequestDurationSeconds,
+	metricHTTPRequestSizeBytes,
+	metricHTTPResponseSizeBytes,
+}
+
+// requestAttributes returns the attribute sets of the single data point of every metric in requestMetrics
+func requestAttributes(t *testing.T, metrics map[string]metricdata.Metrics) map[string]attribute.Set {
+	t.Helper()
+
+	sets := map[string]attribute.Set{
+		metricHTTPRequestsTotal: singleSum(t, metrics, metricHTTPRequestsTotal).Attributes,
+	}
+	for _, name := range requestMetrics[1:] {
+		sets[name] = singleHistogram(t, metrics, name).Attributes
+	}
+
+	return sets
+}
+
+func TestAttributesFunc(t *testing.T) {
+	var gotErr error
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		AttributesFunc: func(c echo.Context, err error) []attribute.KeyValue {
+			gotErr = err
+			return []attribute.KeyValue{
+				attribute.String("tenant_id", c.Request().Header.Get("X-Tenant-ID")),
+				attribute.String("region", "eu"),
+			}
+		},
+	})
+	e.GET("/", func(c echo.Context) error { return echo.ErrTeapot })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	serve(e, req)
+
+	if gotErr != echo.ErrTeapot {
+		t.Fatalf("AttributesFunc got error %v, want %v", gotErr, echo.ErrTeapot)
+	}
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		t.Run(name, func(t *testing.T) {
+			assertAttr(t, attrs, "tenant_id", attribute.StringValue("acme"))
+			assertAttr(t, attrs, "region", attribute.StringValue("eu"))
+			assertAttr(t, attrs, semconv.HTTPRouteKey, attribute.StringValue("/"))
+		})
+	}
+}
+
+func TestAttributeFilter(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		Namespace: "myapp",
+		AttributeFilter: func(metricName string, kv attribute.KeyValue) bool {
+			if kv.Key == semconv.DeploymentEnvironmentKey {
+				return false
+			}
+			return metricName != "myapp_"+metricHTTPRequestSizeBytes || kv.Key != semconv.HTTPRouteKey
+		},
+	})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+
+	metrics := collect(t, reader)
+	size := singleHistogram(t, metrics, "myapp_"+metricHTTPRequestSizeBytes).Attributes
+	assertNoAttr(t, size, semconv.HTTPRouteKey)
+	assertNoAttr(t, size, semconv.DeploymentEnvironmentKey)
+	assertAttr(t, size, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+
+	count := singleSum(t, metrics, "myapp_"+metricHTTPRequestsTotal).Attributes
+	assertAttr(t, count, semconv.HTTPRouteKey, attribute.StringValue("/users/:id"))
+	assertNoAttr(t, count, semconv.DeploymentEnvironmentKey)
+}
+
+func TestRouteNormalizer(t *testing.T) {
+	var normalized []string
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		RouteNormalizer: func(route string) string {
+			normalized = append(normalized, route)
+			if strings.HasPrefix(route, "/v1/") || strings.HasPrefix(route, "/v2/") {
+				return "/vN/" + route[len("/v1/"):]
+			}
+			return route
+		},
+	})
+	e.GET("/v1/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/v2/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/v1/users/1")
+	get(e, "/v2/users/2")
+	get(e, "/v1/missing\xff")
+
+	if got, want := routes(t, reader), map[string]int64{"/vN/users/:id": 2, "/vN/missing�": 1}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+	if want := []string{"/v1/users/:id", "/v2/users/:id", "/v1/missing�"}; !slices.Equal(normalized, want) {
+		t.Fatalf("normalizer called with %q, want %q", normalized, want)
+	}
+}
+
+// fakeClock advances by step on every call
+func fakeClock(step time.Duration) func() time.Time {
+	now := time.Unix(1700000000, 0)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestDurationUnit(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{TimeNow: fakeClock(250 * time.Millisecond)})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	if got := singleHistogram(t, metrics, metricHTTPRequestDurationSeconds).Sum; got != 0.25 {
+		t.Fatalf("request_duration_seconds sum = %v, want 0.25", got)
+	}
+	if unit := metrics[metricHTTPRequestDurationSeconds].Unit; unit != "s" {
+		t.Fatalf("request_duration_seconds unit = %q, want s", unit)
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{DurationUnit: DurationMilliseconds, TimeNow: fakeClock(250 * time.Millisecond)})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	metrics = collect(t, reader)
+	if _, ok := metrics[metricHTTPRequestDurationSeconds]; ok {
+		t.Fatal("request_duration_seconds recorded with DurationMilliseconds")
+	}
+	point := singleHistogram(t, metrics, metricHTTPRequestDurationMillis)
+	if point.Sum != 250 {
+		t.Fatalf("request_duration_milliseconds sum = %v, want 250", point.Sum)
+	}
+	if !slices.Equal(point.Bounds, durationBucketsMillis) {
+		t.Fatalf("request_duration_milliseconds bounds = %v, want %v", point.Bounds, durationBucketsMillis)
+	}
+	if unit := metrics[metricHTTPRequestDurationMillis].Unit; unit != "ms" {
+		t.Fatalf("request_duration_milliseconds unit = %q, want ms", unit)
+	}
+}
+
+func TestResponseSize(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/echo", func(c echo.Context) error { return c.String(http.StatusOK, "hello") })
+	e.GET("/bypass", func(c echo.Context) error {
+		// written to the underlying writer, so not counted in c.Response().Size
+		c.Response().Header().Set(echo.HeaderContentLength, "11")
+		c.Response().WriteHeader(http.StatusOK)
+		_, err := c.Response().Writer.Write([]byte("hello world"))
+		return err
+	})
+	get(e, "/echo")
+	get(e, "/bypass")
+
+	sizes := make(map[string]float64)
+	for _, point := range histogramPoints(t, collect(t, reader), metricHTTPResponseSizeBytes) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		sizes[route.AsString()] = point.Sum
+	}
+	if want := map[string]float64{"/echo": 5, "/bypass": 11}; !maps.Equal(sizes, want) {
+		t.Fatalf("response sizes = %v, want %v", sizes, want)
+	}
+}
+
+func sampledSpanContext() trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01, 0x02, 0x03},
+		SpanID:     trace.SpanID{0x04, 0x05},
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func TestExemplars(t *testing.T) {
+	span := sampledSpanContext()
+
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	// the span is started after the middleware, like a tracing middleware registered after it would
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.SetRequest(c.Request().WithContext(trace.ContextWithSpanContext(c.Request().Context(), span)))
+			return next(c)
+		}
+	})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	exemplars := singleHistogram(t, collect(t, reader), metricHTTPRequestDurationSeconds).Exemplars
+	if len(exemplars) != 1 {
+		t.Fatalf("recorded %d exemplars, want 1", len(exemplars))
+	}
+	traceID, spanID := span.TraceID(), span.SpanID()
+	if !bytes.Equal(exemplars[0].TraceID, traceID[:]) || !bytes.Equal(exemplars[0].SpanID, spanID[:]) {
+		t.Fatalf("exemplar trace %x span %x, want %s %s", exemplars[0].TraceID, exemplars[0].SpanID, traceID, spanID)
+	}
+}
+
+func TestExemplarsUnsampled(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	if exemplars := singleHistogram(t, collect(t, reader), metricHTTPRequestDurationSeconds).Exemplars; len(exemplars) != 0 {
+		t.Fatalf("recorded %d exemplars without a sampled span, want none", len(exemplars))
+	}
+}
+
+func TestMetricSkipper(t *testing.T) {
+	var names []string
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		Namespace: "myapp",
+		MetricSkipper: func(c echo.Context, metricName string) bool {
+			if c.Path() == "/upload" {
+				names = append(names, metricName)
+			}
+			return c.Path() == "/upload" && strings.HasSuffix(metricName, "_bytes")
+		},
+	})
+	e.POST("/upload", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	serve(e, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("data")))
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	for _, name := range []string{metricHTTPRequestSizeBytes, metricHTTPResponseSizeBytes} {
+		point := singleHistogram(t, metrics, "myapp_"+name)
+		assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/"))
+	}
+	if points := sumPoints(t, metrics, "myapp_"+metricHTTPRequestsTotal); len(points) != 2 {
+		t.Fatalf("requests_total has %d data points, want one per route", len(points))
+	}
+	if !slices.Contains(names, "myapp_"+metricHTTPRequestSizeBytes) {
+		t.Fatalf("MetricSkipper called with %q, want namespaced names", names)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/panic", func(c echo.Context) error { panic("boom") })
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("recovered %v, want the handler panic", r)
+			}
+		}()
+		get(e, "/panic")
+	}()
+
+	metrics := collect(t, reader)
+	attrs := singleSum(t, metrics, metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusInternalServerError))
+	assertAttr(t, attrs, attrPanic, attribute.BoolValue(true))
+	if point := singleSum(t, metrics, metricHTTPRequestsInFlight); point.Value != 0 {
+		t.Fatalf("requests_in_flight = %d after panic, want 0", point.Value)
+	}
+	singleSum(t, metrics, metricHTTPRequestsErrorsTotal)
+}
+
+func TestPanicRecoveredUpstream(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	e := echo.New()
+	e.Use(middleware.Recover())
+	e.Use(NewMiddlewareWithConfig(MiddlewareConfig{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))}))
+	e.GET("/panic", func(c echo.Context) error { panic("boom") })
+
+	if rec := get(e, "/panic"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusInternalServerError))
+	assertAttr(t, attrs, attrPanic, attribute.BoolValue(true))
+}
+
+func TestDisablePanicMetric(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{DisablePanicMetric: true})
+	e.GET("/panic", func(c echo.Context) error { panic("boom") })
+
+	func() {
+		defer func() { _ = recover() }()
+		get(e, "/panic")
+	}()
+
+	if _, ok := collect(t, reader)[metricHTTPRequestsTotal]; ok {
+		t.Fatal("requests_total recorded for a panic with DisablePanicMetric")
+	}
+}
+
+func TestLabelFuncs(t *testing.T) {
+	labelFuncs := map[string]LabelValueFunc{
+		"tenant_id": func(c echo.Context, err error) string { return c.Request().Header.Get("X-Tenant-ID") },
+		"failed":    func(c echo.Context, err error) string { return strconv.FormatBool(err != nil) },
+	}
+
+	for _, prefix := range []string{"", "app."} {
+		t.Run("prefix "+prefix, func(t *testing.T) {
+			e, reader := newTestEcho(t, MiddlewareConfig{LabelFuncs: labelFuncs, LabelKeyPrefix: prefix})
+			e.GET("/", func(c echo.Context) error { return echo.ErrNotFound })
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Tenant-ID", "acme")
+			serve(e, req)
+
+			for name, attrs := range requestAttributes(t, collect(t, reader)) {
+				t.Run(name, func(t *testing.T) {
+					assertAttr(t, attrs, attribute.Key(prefix+"tenant_id"), attribute.StringValue("acme"))
+					assertAttr(t, attrs, attribute.Key(prefix+"failed"), attribute.StringValue("true"))
+				})
+			}
+		})
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{IncludeProtocolVersion: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for _, proto := range []struct {
+		proto        string
+		major, minor int
+	}{{"HTTP/1.1", 1, 1}, {"HTTP/2.0", 2, 0}, {"HTTP/1.1", 1, 1}} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Proto, req.ProtoMajor, req.ProtoMinor = proto.proto, proto.major, proto.minor
+		serve(e, req)
+	}
+
+	versions := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		version, _ := point.Attributes.Value(semconv.NetworkProtocolVersionKey)
+		versions[version.AsString()] = point.Value
+	}
+	if want := map[string]int64{"1.1": 2, "2": 1}; !maps.Equal(versions, want) {
+		t.Fatalf("network.protocol.version = %v, want %v", versions, want)
+	}
+}
+
+func TestProtocolVersionDisabled(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	assertNoAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.NetworkProtocolVersionKey)
+}
+
+func TestProtocolVersionParsing(t *testing.T) {
+	for proto, want := range map[string]string{"HTTP/1.0": "1.0", "HTTP/1.1": "1.1", "HTTP/2.0": "2", "HTTP/3.0": "3", "SPDY/3": ""} {
+		if got := protocolVersion(proto); got != want {
+			t.Errorf("protocolVersion(%q) = %q, want %q", proto, got, want)
+		}
+	}
+}
+
+// scopes returns the instrumentation scopes of the metrics collected by reader
+func scopes(t *testing.T, reader sdkmetric.Reader) []instrumentation.Scope {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	var scopes []instrumentation.Scope
+	for _, sm := range rm.ScopeMetrics {
+		scopes = append(scopes, sm.Scope)
+	}
+
+	return scopes
+}
+
+func TestMeterName(t *testing.T) {
+	for name, want := range map[string]string{"": meterName, "github.com/acme/gateway": "github.com/acme/gateway"} {
+		e, reader := newTestEcho(t, MiddlewareConfig{MeterName: name})
+		e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		get(e, "/")
+
+		got := scopes(t, reader)
+		if len(got) != 1 || got[0].Name != want {
+			t.Errorf("MeterName %q: scopes = %v, want %q", name, got, want)
+		}
+	}
+}
+
+func TestInstrumentationVersion(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	got := scopes(t, reader)
+	if len(got) != 1 || got[0].Version != Version {
+		t.Fatalf("scopes = %v, want version %q", got, Version)
+	}
+	if Version == "" {
+		t.Fatal("Version is empty")
+	}
+}
+
+func TestQueryPresenceAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{QueryPresenceAttribute: true})
+	get(e, "/search?q=secret")
+	get(e, "/search")
+
+	presence := make(map[string]bool)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		present, ok := point.Attributes.Value(attrQueryPresent)
+		if !ok {
+			t.Fatalf("attribute %q missing", attrQueryPresent)
+		}
+		if route.AsString() != "/search" {
+			t.Fatalf("route = %q, want the path without query", route.AsString())
+		}
+		presence[present.Emit()] = true
+		for _, kv := range point.Attributes.ToSlice() {
+			if strings.Contains(kv.Value.Emit(), "secret") {
+				t.Fatalf("query recorded in %s", kv.Key)
+			}
+		}
+	}
+	if want := map[string]bool{"true": true, "false": true}; !maps.Equal(presence, want) {
+		t.Fatalf("http.query.present values = %v, want true and false", presence)
+	}
+}
+
+func TestStreamStartCounter(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{StreamStartCounter: true})
+	var started int64
+	var completed bool
+	e.GET("/events", func(c echo.Context) error {
+		metrics := collect(t, reader)
+		started = singleSum(t, metrics, metricHTTPStreamStartedTotal).Value
+		_, completed = metrics[metricHTTPRequestsTotal]
+		return c.String(http.StatusOK, "data: hello\n\n")
+	})
+	get(e, "/events")
+
+	if started != 1 || completed {
+		t.Fatalf("while streaming: stream_started_total = %d, requests_total recorded %v; want 1 and false", started, completed)
+	}
+	attrs := singleSum(t, collect(t, reader), metricHTTPStreamStartedTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPRouteKey, attribute.StringValue("/events"))
+	assertAttr(t, attrs, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+}
+
+func TestNilResponse(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mw, err := MiddlewareConfig{
+		MeterProvider:                sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		ResponseContentTypeAttribute: true,
+		GRPCStatusAttribute:          true,
+		CountResponseBytes:           true,
+	}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	c.SetResponse(nil)
+	if err := mw(func(c echo.Context) error { return nil })(c); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := collect(t, reader)
+	attrs := singleSum(t, metrics, metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, attrResponseMissing, attribute.BoolValue(true))
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(0))
+	if size := singleHistogram(t, metrics, metricHTTPResponseSizeBytes).Sum; size != 0 {
+		t.Fatalf("response size = %v, want 0", size)
+	}
+}
+
+func TestToMiddlewareWithInstruments(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	_, instruments, err := MiddlewareConfig{
+		MeterProvider:       sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		DisableResponseSize: true,
+	}.ToMiddlewareWithInstruments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if instruments.RequestCount == nil || instruments.RequestDuration == nil || instruments.RequestSize == nil {
+		t.Fatalf("enabled instruments missing: %+v", instruments)
+	}
+	if instruments.ResponseSize != nil {
+		t.Fatal("disabled ResponseSize instrument is not nil")
+	}
+
+	instruments.RequestCount.Add(context.Background(), 3, metric.WithAttributes(attribute.String("job", "import")))
+	point := singleSum(t, collect(t, reader), metricHTTPRequestsTotal)
+	if point.Value != 3 {
+		t.Fatalf("requests_total = %d, want 3", point.Value)
+	}
+	assertAttr(t, point.Attributes, "job", attribute.StringValue("import"))
+}
+
+func TestTimeNow(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{TimeNow: fakeClock(3 * time.Second)})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+	get(e, "/")
+
+	point := singleHistogram(t, collect(t, reader), metricHTTPRequestDurationSeconds)
+	if point.Count != 2 || point.Sum != 6 {
+		t.Fatalf("request_duration_seconds count %d sum %v, want 2 and 6", point.Count, point.Sum)
+	}
+	// 3s lands in the (2.5, 5] bucket
+	if i := slices.Index(point.Bounds, 5); point.BucketCounts[i] != 2 {
+		t.Fatalf("bucket counts = %v, want both requests at le 5", point.BucketCounts)
+	}
+}
+
+func TestSanitizeAttributeValue(t *testing.T) {
+	tests := []struct {
+		value  string
+		maxLen int
+		want   string
+	}{
+		{"/users/:id", 20, "/users/:id"},
+		{"/users\n/\x00:id", 20, "/users/:id"},
+		{"/very/long/route", 8, "/very/l…"},
+		{"/héllo/wörld", 7, "/héllo…"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeAttributeValue(tt.value, tt.maxLen); got != tt.want {
+			t.Errorf("sanitizeAttributeValue(%q, %d) = %q, want %q", tt.value, tt.maxLen, got, tt.want)
+		}
+	}
+}
+
+func TestMaxAttributeValueLength(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		MaxAttributeValueLength: 10,
+		LabelFuncs: map[string]LabelValueFunc{
+			"user_agent": func(c echo.Context, err error) string { return c.Request().UserAgent() },
+		},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/some/very/long/unmatched/path", nil)
+	req.Header.Set("User-Agent", "agent\twith\x7fcontrol")
+	serve(e, req)
+
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPRouteKey, attribute.StringValue("/some/ver…"))
+	assertAttr(t, attrs, "user_agent", attribute.StringValue("agentwith…"))
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusNotFound))
+}
+
+func TestDefaultClassifyError(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+		want   bool
+	}{
+		{http.StatusOK, nil, false},
+		{http.StatusNotFound, echo.ErrNotFound, false},
+		{http.StatusInternalServerError, nil, true},
+		{http.StatusBadGateway, echo.ErrBadGateway, true},
+		{http.StatusInternalServerError, errors.New("boom"), true},
+		{http.StatusOK, errors.New("boom"), true},
+	}
+	for _, tt := range tests {
+		if got := DefaultClassifyError(tt.status, tt.err); got != tt.want {
+			t.Errorf("DefaultClassifyError(%d, %v) = %t, want %t", tt.status, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		ClassifyError: func(status int, err error) bool { return status == http.StatusTooManyRequests },
+	})
+	e.GET("/limited", func(c echo.Context) error { return c.NoContent(http.StatusTooManyRequests) })
+	e.GET("/fail", func(c echo.Context) error { return errors.New("boom") })
+	get(e, "/limited")
+	get(e, "/fail")
+
+	point := singleSum(t, collect(t, reader), metricHTTPRequestsErrorsTotal)
+	assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/limited"))
+	assertAttr(t, point.Attributes, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusTooManyRequests))
+	if point.Value != 1 {
+		t.Fatalf("requests_errors_total = %d, want 1", point.Value)
+	}
+}
+
+func TestOnObserve(t *testing.T) {
+	var observations []Observation
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		TimeNow:   fakeClock(250 * time.Millisecond),
+		OnObserve: func(o Observation) { observations = append(observations, o) },
+	})
+	e.POST("/users/:id", func(c echo.Context) error { return c.String(http.StatusCreated, "created") })
+	req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader("payload"))
+	reqSize := int64(computeApproximateRequestSize(req))
+	serve(e, req)
+
+	if len(observations) != 1 {
+		t.Fatalf("OnObserve called %d times, want 1", len(observations))
+	}
+	o := observations[0]
+	if o.Route != "/users/:id" || o.Method != http.MethodPost || o.Status != http.StatusCreated {
+		t.Fatalf("observation = %+v", o)
+	}
+	if o.Duration != 250*time.Millisecond {
+		t.Fatalf("duration = %s, want 250ms", o.Duration)
+	}
+	if o.RequestSize != reqSize {
+		t.Fatalf("request size = %d, want %d", o.RequestSize, reqSize)
+	}
+	if o.ResponseSize != int64(len("created")) {
+		t.Fatalf("response size = %d, want %d", o.ResponseSize, len("created"))
+	}
+	point := singleSum(t, collect(t, reader), metricHTTPRequestsTotal)
+	if got := attribute.NewSet(o.Attributes...); !got.Equals(&point.Attributes) {
+		t.Fatalf("observation attributes = %v, want %v", got.Encoded(attribute.DefaultEncoder()), point.Attributes.Encoded(attribute.DefaultEncoder()))
+	}
+}
+
+func TestWildcardRoute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/static/*", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/static/app.css")
+	get(e, "/static/js/app.js")
+
+	if got, want := routes(t, reader), map[string]int64{"/static/*": 2}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func TestServiceVersion(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{ServiceVersion: "1.2.3"})
+	get(e, "/")
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		if v, _ := attrs.Value(semconv.ServiceVersionKey); v.AsString() != "1.2.3" {
+			t.Errorf("%s service.version = %q, want 1.2.3", name, v.AsString())
+		}
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	get(e, "/")
+	assertNoAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ServiceVersionKey)
+}
+
+func TestSharedInstruments(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	const n = 50
+	apps := make([]*echo.Echo, n)
+	var wg sync.WaitGroup
+	for i := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mw, err := MiddlewareConfig{
+				MeterProvider: provider,
+				ServiceName:   "service-" + strconv.Itoa(i),
+			}.ToMiddleware()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			apps[i] = echo.New()
+			apps[i].Use(mw)
+			apps[i].GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+	for _, e := range apps {
+		get(e, "/")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("collected %d scopes, want 1", len(rm.ScopeMetrics))
+	}
+	registered := make(map[string]int)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		registered[m.Name]++
+	}
+	for _, name := range requestMetrics {
+		if registered[name] != 1 {
+			t.Errorf("%s registered %d times, want 1", name, registered[name])
+		}
+	}
+
+	services := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		service, _ := point.Attributes.Value(semconv.ServiceNameKey)
+		services[service.AsString()] += point.Value
+	}
+	if len(services) != n {
+		t.Fatalf("requests_total has %d services, want %d", len(services), n)
+	}
+	for service, count := range services {
+		if count != 1 {
+			t.Errorf("requests_total{service.name=%q} = %d, want 1", service, count)
+		}
+	}
+}
+
+func TestServiceNameFunc(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		ServiceName: "static",
+		ServiceNameFunc: func(c echo.Context) string {
+			return c.Request().Header.Get("X-Tenant")
+		},
+	})
+	for _, tenant := range []string{"billing", "billing", "search"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tenant", tenant)
+		serve(e, req)
+	}
+
+	services := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		service, _ := point.Attributes.Value(semconv.ServiceNameKey)
+		services[service.AsString()] = point.Value
+	}
+	if want := map[string]int64{"billing": 2, "search": 1}; !maps.Equal(services, want) {
+		t.Fatalf("requests_total by service.name = %v, want %v", services, want)
+	}
+}
+
+func TestBaggageKeys(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{BaggageKeys: []string{"tenant", "plan"}})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	tenant, err := baggage.NewMember("tenant", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	region, err := baggage.NewMember("region", "eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(tenant, region)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	serve(e, req.WithContext(baggage.ContextWithBaggage(req.Context(), bag)))
+
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, "baggage.tenant", attribute.StringValue("acme"))
+	assertNoAttr(t, attrs, "baggage.plan")
+	assertNoAttr(t, attrs, "baggage.region")
+}
+
+func TestRequestSizeFunc(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		RequestSizeFunc: func(r *http.Request) int64 { return 42 },
+	})
+	e.POST("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	serve(e, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload")))
+
+	point := singleHistogram(t, collect(t, reader), metricHTTPRequestSizeBytes)
+	if point.Count != 1 || point.Sum != 42 {
+		t.Fatalf("request_size_bytes count = %d sum = %v, want 1 and 42", point.Count, point.Sum)
+	}
+}
+
+func TestNormalizeMethod(t *testing.T) {
+	for method, want := range map[string]string{
+		http.MethodGet:   http.MethodGet,
+		http.MethodPatch: http.MethodPatch,
+		"FOOBAR":         "_OTHER",
+		"get":            "_OTHER",
+	} {
+		if got := normalizeMethod(method); got != want {
+			t.Errorf("normalizeMethod(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
+
+func TestNormalizeMethodAttribute(t *testing.T) {
+	tests := []struct {
+		method   string
+		want     string
+		original string
+	}{
+		{http.MethodGet, http.MethodGet, ""},
+		{"FOOBAR", "_OTHER", "FOOBAR"},
+		{"get", "_OTHER", "get"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			e, reader := newTestEcho(t, MiddlewareConfig{NormalizeMethod: true})
+			serve(e, httptest.NewRequest(tt.method, "/", nil))
+
+			for name, attrs := range requestAttributes(t, collect(t, reader)) {
+				if v, _ := attrs.Value(semconv.HTTPRequestMethodKey); v.AsString() != tt.want {
+					t.Errorf("%s http.request.method = %q, want %q", name, v.AsString(), tt.want)
+				}
+				if tt.original == "" {
+					assertNoAttr(t, attrs, semconv.HTTPRequestMethodOriginalKey)
+				} else {
+					assertAttr(t, attrs, semconv.HTTPRequestMethodOriginalKey, attribute.StringValue(tt.original))
+				}
+			}
+		})
+	}
+
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	serve(e, httptest.NewRequest("FOOBAR", "/", nil))
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPRequestMethodKey, attribute.StringValue("FOOBAR"))
+	assertNoAttr(t, attrs, semconv.HTTPRequestMethodOriginalKey)
+}
+
+func TestStaticAttributes(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		StaticAttributes: []attribute.KeyValue{
+			attribute.String("region", "us"),
+			attribute.String("region", "eu"),
+			attribute.String("tier", "gold"),
+		},
+		LabelFuncs: map[string]LabelValueFunc{
+			"tier": func(c echo.Context, err error) string { return "silver" },
+		},
+	})
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	for name, attrs := range requestAttributes(t, metrics) {
+		if v, _ := attrs.Value("region"); v.AsString() != "eu" {
+			t.Errorf("%s region = %q, want eu", name, v.AsString())
+		}
+		if v, _ := attrs.Value("tier"); v.AsString() != "gold" {
+			t.Errorf("%s tier = %q, want gold", name, v.AsString())
+		}
+	}
+	inFlight := metrics[metricHTTPRequestsInFlight].Data.(metricdata.Sum[int64]).DataPoints
+	if len(inFlight) != 1 {
+		t.Fatalf("requests_in_flight has %d points, want 1", len(inFlight))
+	}
+	assertAttr(t, inFlight[0].Attributes, "region", attribute.StringValue("eu"))
+}
+
+func TestUnits(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/fail", func(c echo.Context) error { return errors.New("boom") })
+	get(e, "/fail")
+
+	metrics := collect(t, reader)
+	for name, want := range map[string]string{
+		metricHTTPRequestsTotal:          "{request}",
+		metricHTTPRequestsErrorsTotal:    "{request}",
+		metricHTTPRequestsInFlight:       "{request}",
+		metricHTTPRequestDurationSeconds: "s",
+		metricHTTPRequestSizeBytes:       "By",
+		metricHTTPResponseSizeBytes:      "By",
+	} {
+		m, ok := metrics[name]
+		if !ok {
+			t.Errorf("%s not recorded", name)
+			continue
+		}
+		if m.Unit != want {
+			t.Errorf("%s unit = %q, want %q", name, m.Unit, want)
+		}
+	}
+}
+
+func TestSlowRequestThreshold(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		SlowRequestThreshold: time.Second,
+		TimeNow:              func() time.Time { return now },
+	})
+	e.GET("/slow", func(c echo.Context) error {
+		now = now.Add(2 * time.Second)
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/fast", func(c echo.Context) error {
+		now = now.Add(100 * time.Millisecond)
+		return c.NoContent(http.StatusOK)
+	})
+	get(e, "/slow")
+	get(e, "/fast")
+
+	point := singleSum(t, collect(t, reader), metricSlowRequestsTotal)
+	assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/slow"))
+	assertAttr(t, point.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+	if point.Value != 1 {
+		t.Fatalf("slow_requests_total = %d, want 1", point.Value)
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	get(e, "/")
+	if _, ok := collect(t, reader)[metricSlowRequestsTotal]; ok {
+		t.Fatal("slow_requests_total recorded without a threshold")
+	}
+}
+
+func TestDisableServiceNameAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{ServiceName: "api", DisableServiceNameAttribute: true})
+	get(e, "/")
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		if _, ok := attrs.Value(semconv.ServiceNameKey); ok {
+			t.Errorf("%s has service.name although disabled", name)
+		}
+		if _, ok := attrs.Value(semconv.ServiceInstanceIDKey); !ok {
+			t.Errorf("%s has no service.instance.id", name)
+		}
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{ServiceName: "api"})
+	get(e, "/")
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ServiceNameKey, attribute.StringValue("api"))
+}
+
+func TestSchemeAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+	secure := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	secure.TLS = &tls.ConnectionState{}
+	serve(e, secure)
+	forwarded := httptest.NewRequest(http.MethodGet, "/", nil)
+	forwarded.Header.Set(echo.HeaderXForwardedProto, "https")
+	serve(e, forwarded)
+
+	schemes := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		scheme, _ := point.Attributes.Value(semconv.URLSchemeKey)
+		schemes[scheme.AsString()] += point.Value
+	}
+	if want := map[string]int64{"http": 1, "https": 2}; !maps.Equal(schemes, want) {
+		t.Fatalf("url.scheme = %v, want %v", schemes, want)
+	}
+}
+
+func TestBucketHelpers(t *testing.T) {
+	for name, buckets := range map[string]func() []float64{
+		"DefaultDurationBuckets": DefaultDurationBuckets,
+		"LatencyBucketsMillis":   LatencyBucketsMillis,
+		"SizeBucketsKB":          SizeBucketsKB,
+	} {
+		got := buckets()
+		if len(got) == 0 {
+			t.Errorf("%s() is empty", name)
+		}
+		if !slices.IsSorted(got) || len(slices.Compact(slices.Clone(got))) != len(got) {
+			t.Errorf("%s() = %v, want strictly ascending", name, got)
+		}
+		got[0] = -1
+		if buckets()[0] == -1 {
+			t.Errorf("%s() returns a shared slice", name)
+		}
+	}
+
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		DurationUnit:        DurationMilliseconds,
+		DurationBuckets:     LatencyBucketsMillis(),
+		RequestSizeBuckets:  SizeBucketsKB(),
+		ResponseSizeBuckets: SizeBucketsKB(),
+	})
+	get(e, "/")
+	metrics := collect(t, reader)
+	if got := singleHistogram(t, metrics, metricHTTPRequestDurationMillis).Bounds; !slices.Equal(got, LatencyBucketsMillis()) {
+		t.Fatalf("request_duration_milliseconds bounds = %v, want %v", got, LatencyBucketsMillis())
+	}
+	if got := singleHistogram(t, metrics, metricHTTPRequestSizeBytes).Bounds; !slices.Equal(got, SizeBucketsKB()) {
+		t.Fatalf("request_size_bytes bounds = %v, want %v", got, SizeBucketsKB())
+	}
+}
+
+func TestRecordClientDisconnects(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{RecordClientDisconnects: true})
+	e.GET("/", func(c echo.Context) error {
+		<-c.Request().Context().Done()
+		return c.Request().Context().Err()
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	serve(e, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		if v, _ := attrs.Value(semconv.HTTPResponseStatusCodeKey); v.AsInt64() != statusClientClosedRequest {
+			t.Errorf("%s http.response.status_code = %d, want %d", name, v.AsInt64(), statusClientClosedRequest)
+		}
+		if v, _ := attrs.Value(attrCanceled); !v.AsBool() {
+			t.Errorf("%s has no canceled=true attribute", name)
+		}
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.Request().Context().Err() })
+	serve(e, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusInternalServerError))
+	assertNoAttr(t, attrs, attrCanceled)
+}
+
+func TestCommittedStatus(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/before", func(c echo.Context) error { return errors.New("boom") })
+	e.GET("/after", func(c echo.Context) error {
+		if err := c.String(http.StatusOK, "partial"); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	})
+	e.GET("/http-error", func(c echo.Context) error { return echo.NewHTTPError(http.StatusConflict) })
+	get(e, "/before")
+	get(e, "/after")
+	get(e, "/http-error")
+
+	statuses := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		status, _ := point.Attributes.Value(semconv.HTTPResponseStatusCodeKey)
+		statuses[route.AsString()] = status.AsInt64()
+	}
+	want := map[string]int64{"/before": http.StatusInternalServerError, "/after": http.StatusOK, "/http-error": http.StatusConflict}
+	if !maps.Equal(statuses, want) {
+		t.Fatalf("statuses = %v, want %v", statuses, want)
+	}
+}
+
+func TestSkipZeroSize(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		e, reader := newTestEcho(t, MiddlewareConfig{SkipZeroSize: skip, RequestSizeFunc: func(r *http.Request) int64 { return 0 }})
+		e.DELETE("/", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+		serve(e, httptest.NewRequest(http.MethodDelete, "/", nil))
+
+		metrics := collect(t, reader)
+		for _, name := range []string{metricHTTPRequestSizeBytes, metricHTTPResponseSizeBytes} {
+			m, recorded := metrics[name]
+			if recorded && len(m.Data.(metricdata.Histogram[float64]).DataPoints) == 0 {
+				recorded = false
+			}
+			if recorded == skip {
+				t.Errorf("SkipZeroSize=%t: %s recorded = %t", skip, name, recorded)
+			}
+			if recorded {
+				if point := singleHistogram(t, metrics, name); point.Count != 1 || point.Sum != 0 {
+					t.Errorf("%s count = %d sum = %v, want a single 0", name, point.Count, point.Sum)
+				}
+			}
+		}
+		if got := singleSum(t, metrics, metricHTTPRequestsTotal).Value; got != 1 {
+			t.Errorf("SkipZeroSize=%t: requests_total = %d, want 1", skip, got)
+		}
+	}
+}
+
+func TestSizeBucketAdvice(t *testing.T) {
+	advice := []float64{10, 100, 1000}
+	e, reader := newTestEcho(t, MiddlewareConfig{SizeBucketAdvice: advice, ResponseSizeBuckets: []float64{1, 2}})
+	get(e, "/")
+	metrics := collect(t, reader)
+	if got := singleHistogram(t, metrics, metricHTTPRequestSizeBytes).Bounds; !slices.Equal(got, advice) {
+		t.Fatalf("request_size_bytes bounds = %v, want advice %v", got, advice)
+	}
+	if got := singleHistogram(t, metrics, metricHTTPResponseSizeBytes).Bounds; !slices.Equal(got, []float64{1, 2}) {
+		t.Fatalf("response_size_bytes bounds = %v, want ResponseSizeBuckets", got)
+	}
+
+	// views take precedence over the advice
+	viewBuckets := []float64{5, 50}
+	reader = sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(sdkmetric.NewView(
+		sdkmetric.Instrument{Name: metricHTTPRequestSizeBytes},
+		sdkmetric.Stream{Aggregation: sdkmetric.AggregationExplicitBucketHistogram{Boundaries: viewBuckets}},
+	)))
+	mw, err := MiddlewareConfig{MeterProvider: provider, SizeBucketAdvice: advice}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = echo.New()
+	e.Use(mw)
+	get(e, "/")
+	if got := singleHistogram(t, collect(t, reader), metricHTTPRequestSizeBytes).Bounds; !slices.Equal(got, viewBuckets) {
+		t.Fatalf("request_size_bytes bounds = %v, want view buckets %v", got, viewBuckets)
+	}
+}
+
+func TestDownstreamErrorHandlerStatus(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	// maps errors to 422 but still returns them, like logging error middlewares do
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				_ = c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			}
+			return err
+		}
+	})
+	e.GET("/", func(c echo.Context) error { return echo.NewHTTPError(http.StatusInternalServerError, "stale") })
+	get(e, "/")
+
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		if v, _ := attrs.Value(semconv.HTTPResponseStatusCodeKey); v.AsInt64() != http.StatusUnprocessableEntity {
+			t.Errorf("%s http.response.status_code = %d, want %d", name, v.AsInt64(), http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestDefaultUnwrittenStatus(t *testing.T) {
+	unwritten := func(c echo.Context) error { return nil }
+	written := func(c echo.Context) error { return c.NoContent(http.StatusAccepted) }
+	zero, teapot := 0, http.StatusTeapot
+	tests := []struct {
+		name    string
+		status  *int
+		handler echo.HandlerFunc
+		want    int
+	}{
+		{"default", nil, unwritten, http.StatusOK},
+		{"zero", &zero, unwritten, 0},
+		{"configured", &teapot, unwritten, http.StatusTeapot},
+		{"written", &zero, written, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, reader := newTestEcho(t, MiddlewareConfig{DefaultUnwrittenStatus: tt.status})
+			e.GET("/", tt.handler)
+			get(e, "/")
+
+			for name, attrs := range requestAttributes(t, collect(t, reader)) {
+				if v, _ := attrs.Value(semconv.HTTPResponseStatusCodeKey); v.AsInt64() != int64(tt.want) {
+					t.Errorf("%s http.response.status_code = %d, want %d", name, v.AsInt64(), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSizeSampleRate(t *testing.T) {
+	const requests = 200
+	seeded := func() func() float64 { return rand.New(rand.NewPCG(1, 2)).Float64 }
+
+	// replays the seeded generator to get the number of requests sampled at 0.5
+	var sampled uint64
+	replay := seeded()
+	for range requests {
+		if replay() < 0.5 {
+			sampled++
+		}
+	}
+
+	for _, tt := range []struct {
+		rate float64
+		want uint64
+	}{
+		{0, 0},
+		{0.5, sampled},
+		{1, requests},
+	} {
+		e, reader := newTestEcho(t, MiddlewareConfig{SizeSampleRate: &tt.rate, SizeSampleRand: seeded()})
+		for range requests {
+			get(e, "/")
+		}
+
+		metrics := collect(t, reader)
+		if got := singleSum(t, metrics, metricHTTPRequestsTotal).Value; got != requests {
+			t.Errorf("rate %v: requests_total = %d, want %d", tt.rate, got, requests)
+		}
+		if got := singleHistogram(t, metrics, metricHTTPRequestDurationSeconds).Count; got != requests {
+			t.Errorf("rate %v: request_duration_seconds count = %d, want %d", tt.rate, got, requests)
+		}
+		for _, name := range []string{metricHTTPRequestSizeBytes, metricHTTPResponseSizeBytes} {
+			var got uint64
+			if m, ok := metrics[name]; ok {
+				for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					got += point.Count
+				}
+			}
+			if got != tt.want {
+				t.Errorf("rate %v: %s count = %d, want %d", tt.rate, name, got, tt.want)
+			}
+		}
+	}
+
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	get(e, "/")
+	if got := singleHistogram(t, collect(t, reader), metricHTTPRequestSizeBytes).Count; got != 1 {
+		t.Fatalf("request_size_bytes count = %d without sampling, want 1", got)
+	}
+}
+
+func TestSizeSampleRateInvalid(t *testing.T) {
+	rate := 1.5
+	if _, err := (MiddlewareConfig{MeterProvider: sdkmetric.NewMeterProvider(), SizeSampleRate: &rate}).ToMiddleware(); err == nil {
+		t.Fatal("SizeSampleRate above 1 accepted")
+	}
+}
+
+func TestMeasureOverhead(t *testing.T) {
+	// every reading advances the clock by a microsecond, the handler by ten milliseconds
+	now := time.Unix(1700000000, 0)
+	e, reader := newTestEcho(t, MiddlewareConfig{MeasureOverhead: true, TimeNow: func() time.Time {
+		now = now.Add(time.Microsecond)
+		return now
+	}})
+	e.GET("/users/:id", func(c echo.Context) error {
+		now = now.Add(10 * time.Millisecond)
+		return c.NoContent(http.StatusOK)
+	})
+	get(e, "/users/1")
+
+	metrics := collect(t, reader)
+	point := singleHistogram(t, metrics, metricMiddlewareOverhead)
+	assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/users/:id"))
+	assertAttr(t, point.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+	if point.Count != 1 || point.Sum <= 0 {
+		t.Fatalf("middleware overhead count = %d sum = %v, want a single positive value", point.Count, point.Sum)
+	}
+	if !slices.Equal(point.Bounds, overheadBuckets) {
+		t.Fatalf("middleware overhead bounds = %v, want %v", point.Bounds, overheadBuckets)
+	}
+	if duration := singleHistogram(t, metrics, metricHTTPRequestDurationSeconds).Sum; point.Sum >= duration {
+		t.Fatalf("middleware overhead = %vs, want less than the request duration of %vs", point.Sum, duration)
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	get(e, "/")
+	if _, ok := collect(t, reader)[metricMiddlewareOverhead]; ok {
+		t.Fatal("middleware overhead recorded although disabled")
+	}
+}
+
+func TestDoNotUseRequestPathFor404(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{DoNotUseRequestPathFor404: true})
+	get(e, "/missing")
+	get(e, "/other")
+
+	if got, want := routes(t, reader), map[string]int64{defaultUnmatchedRouteLabel: 2}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{DoNotUseRequestPathFor404: true, UnmatchedRouteLabel: "unmatched"})
+	get(e, "/missing")
+	if got, want := routes(t, reader), map[string]int64{"unmatched": 1}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func TestContextKeys(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{ContextKeys: []string{"tenant_id", "plan", "missing"}})
+	e.GET("/", func(c echo.Context) error {
+		c.Set("tenant_id", 42)
+		c.Set("plan", nil)
+		return c.NoContent(http.StatusOK)
+	})
+	get(e, "/")
+
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		if v, _ := attrs.Value("ctx.tenant_id"); v.AsString() != "42" {
+			t.Errorf("%s ctx.tenant_id = %q, want 42", name, v.AsString())
+		}
+		assertNoAttr(t, attrs, "ctx.plan")
+		assertNoAttr(t, attrs, "ctx.missing")
+	}
+}
+
+func TestDescriptions(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		Namespace:    "api",
+		Descriptions: map[string]string{"api_" + metricHTTPRequestsTotal: "Number of HTTP requests."},
+	})
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	if got := metrics["api_"+metricHTTPRequestsTotal].Description; got != "Number of HTTP requests." {
+		t.Fatalf("requests_total description = %q, want the override", got)
+	}
+	if got := metrics["api_"+metricHTTPRequestSizeBytes].Description; got != "The HTTP request sizes in bytes." {
+		t.Fatalf("request_size_bytes description = %q, want the default", got)
+	}
+}
+
+func TestDedupAttributes(t *testing.T) {
+	got := dedupAttributes([]attribute.KeyValue{
+		attribute.String("a", "1"),
+		attribute.String("b", "1"),
+		attribute.String("a", "2"),
+		attribute.String("c", "1"),
+		attribute.String("b", "2"),
+	})
+	want := []attribute.KeyValue{attribute.String("a", "2"), attribute.String("b", "2"), attribute.String("c", "1")}
+	if !slices.Equal(got, want) {
+		t.Fatalf("dedupAttributes = %v, want %v", got, want)
+	}
+}
+
+func TestCollidingAttributes(t *testing.T) {
+	var observed []attribute.KeyValue
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		AttributesFunc: func(c echo.Context, err error) []attribute.KeyValue {
+			return []attribute.KeyValue{semconv.HTTPRoute("/custom")}
+		},
+		OnObserve: func(o Observation) { observed = o.Attributes },
+	})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+
+	var routes int
+	for _, kv := range observed {
+		if kv.Key == semconv.HTTPRouteKey {
+			routes++
+		}
+	}
+	if routes != 1 {
+		t.Fatalf("recorded attributes %v have %d http.route attributes, want 1", observed, routes)
+	}
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		if v, _ := attrs.Value(semconv.HTTPRouteKey); v.AsString() != "/custom" {
+			t.Errorf("%s http.route = %q, want /custom", name, v.AsString())
+		}
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{HandleError: true})
+	var handled int
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+		handled++
+		_ = c.NoContent(http.StatusTeapot)
+	}
+	e.GET("/", func(c echo.Context) error { return echo.NewHTTPError(http.StatusInternalServerError) })
+	rec := get(e, "/")
+
+	if rec.Code != http.StatusTeapot || handled != 1 {
+		t.Fatalf("response status = %d after %d error handler calls, want 418 after 1", rec.Code, handled)
+	}
+	for name, attrs := range requestAttributes(t, collect(t, reader)) {
+		if v, _ := attrs.Value(semconv.HTTPResponseStatusCodeKey); v.AsInt64() != http.StatusTeapot {
+			t.Errorf("%s http.response.status_code = %d, want %d", name, v.AsInt64(), http.StatusTeapot)
+		}
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	e.HTTPErrorHandler = func(err error, c echo.Context) { _ = c.NoContent(http.StatusTeapot) }
+	e.GET("/", func(c echo.Context) error { return echo.NewHTTPError(http.StatusInternalServerError) })
+	get(e, "/")
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusInternalServerError))
+}
+
+func TestServerPort(t *testing.T) {
+	listener := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9090}
+	tests := []struct {
+		host  string
+		tls   bool
+		local net.Addr
+		want  int
+	}{
+		{"example.com:8443", false, nil, 8443},
+		{"example.com", false, nil, 80},
+		{"example.com", true, nil, 443},
+		{"[::1]:8080", false, nil, 8080},
+		{"example.com", false, listener, 9090},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tt.host
+		if tt.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		if tt.local != nil {
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, tt.local))
+		}
+
+		e, reader := newTestEcho(t, MiddlewareConfig{ServerPortAttribute: true})
+		serve(e, req)
+		attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+		if v, _ := attrs.Value(semconv.ServerPortKey); v.AsInt64() != int64(tt.want) {
+			t.Errorf("host %q (tls %t, local %v): server.port = %d, want %d", tt.host, tt.tls, tt.local, v.AsInt64(), tt.want)
+		}
+	}
+
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	get(e, "/")
+	assertNoAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ServerPortKey)
+}
+
+func TestServiceNameFromEnvironment(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "from-env")
+
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	get(e, "/")
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ServiceNameKey, attribute.StringValue("from-env"))
+
+	e, reader = newTestEcho(t, MiddlewareConfig{ServiceName: "explicit"})
+	get(e, "/")
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ServiceNameKey, attribute.StringValue("explicit"))
+
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	get(e, "/")
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.ServiceNameKey, attribute.StringValue(defaultServiceName))
+}
+
+func TestRecordPredicate(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		RecordPredicate: func(c echo.Context, err error) bool { return c.Request().Header.Get("Authorization") != "" },
+	})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	authenticated := httptest.NewRequest(http.MethodGet, "/", nil)
+	authenticated.Header.Set("Authorization", "Bearer token")
+	serve(e, authenticated)
+	get(e, "/")
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	if got := singleSum(t, metrics, metricHTTPRequestsTotal).Value; got != 3 {
+		t.Fatalf("requests_total = %d, want every request", got)
+	}
+	for _, name := range []string{metricHTTPRequestDurationSeconds, metricHTTPRequestSizeBytes, metricHTTPResponseSizeBytes} {
+		if got := singleHistogram(t, metrics, name).Count; got != 1 {
+			t.Errorf("%s count = %d, want only the authenticated request", name, got)
+		}
+	}
+}
+
+func TestSeparatePreflightMetrics(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{SeparatePreflightMetrics: true})
+	e.Use(middleware.CORS())
+	e.GET("/api", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	preflight := httptest.NewRequest(http.MethodOptions, "/api", nil)
+	preflight.Header.Set(echo.HeaderOrigin, "https://example.com")
+	preflight.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodGet)
+	serve(e, preflight)
+	get(e, "/api")
+
+	metrics := collect(t, reader)
+	point := singleSum(t, metrics, metricPreflightRequestsTotal)
+	assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/api"))
+	if point.Value != 1 {
+		t.Fatalf("preflight_requests_total = %d, want 1", point.Value)
+	}
+	duration := singleHistogram(t, metrics, metricHTTPRequestDurationSeconds)
+	assertAttr(t, duration.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+	if duration.Count != 1 {
+		t.Fatalf("request_duration_seconds count = %d, want the OPTIONS request excluded", duration.Count)
+	}
+}
+
+func TestServerAddressIPv6(t *testing.T) {
+	tests := map[string]string{
+		"example.com":   "example.com",
+		"[::1]":         "::1",
+		"[::1]:8080":    "::1",
+		"[2001:db8::1]": "2001:db8::1",
+	}
+	for host, want := range tests {
+		if got := serverAddress(host); got != want {
+			t.Errorf("serverAddress(%q) = %q, want %q", host, got, want)
+		}
+	}
+
+	e, reader := newTestEcho(t, MiddlewareConfig{BuiltinAttributes: DefaultBuiltinAttributes | BuiltinHost})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "[::1]"
+	serve(e, req)
+
+	attrs := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes
+	assertAttr(t, attrs, semconv.ServerAddressKey, attribute.StringValue("::1"))
+}
+
+func TestDetailedErrorsOnly(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{DetailedErrorsOnly: true})
+	e.GET("/ok", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/fail", func(c echo.Context) error { return echo.ErrServiceUnavailable })
+	get(e, "/ok")
+	get(e, "/ok")
+	get(e, "/fail")
+
+	metrics := collect(t, reader)
+	success := singleSum(t, metrics, metricSuccessfulRequestsTotal)
+	if success.Value != 2 {
+		t.Fatalf("successful_requests_total = %d, want 2", success.Value)
+	}
+	assertAttr(t, success.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/ok"))
+	assertAttr(t, success.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+	assertNoAttr(t, success.Attributes, semconv.HTTPResponseStatusCodeKey)
+
+	count := singleSum(t, metrics, metricHTTPRequestsTotal)
+	assertAttr(t, count.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/fail"))
+	assertAttr(t, count.Attributes, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusServiceUnavailable))
+	if duration := singleHistogram(t, metrics, metricHTTPRequestDurationSeconds); duration.Count != 1 {
+		t.Fatalf("request_duration_seconds count = %d, want only the failed request", duration.Count)
+	}
+}
+
+func TestNodeName(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{NodeName: "node-1", UseHostnameAsNode: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, attrNodeName, attribute.StringValue("node-1"))
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("no hostname: %v", err)
+	}
+	e, reader = newTestEcho(t, MiddlewareConfig{UseHostnameAsNode: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+	assertAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, attrNodeName, attribute.StringValue(hostname))
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+	assertNoAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, attrNodeName)
+}
+
+func TestRecordWithBackgroundContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		conf         MiddlewareConfig
+		wantErr      error
+		wantDeadline bool
+	}{
+		{name: "request context", wantErr: context.Canceled},
+		{name: "background", conf: MiddlewareConfig{RecordWithBackgroundContext: true}},
+		{name: "timeout", conf: MiddlewareConfig{RecordWithBackgroundContext: true, RecordTimeout: time.Minute}, wantDeadline: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var canceled bool
+			var errs []error
+			var deadlines []bool
+			reader := sdkmetric.NewManualReader()
+			tt.conf.MeterProvider = sdkmetric.NewMeterProvider(
+				sdkmetric.WithReader(reader),
+				sdkmetric.WithExemplarFilter(func(ctx context.Context) bool {
+					if canceled {
+						_, ok := ctx.Deadline()
+						errs = append(errs, ctx.Err())
+						deadlines = append(deadlines, ok)
+					}
+					return false
+				}),
+			)
+			mw, err := tt.conf.ToMiddleware()
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := echo.New()
+			e.Use(mw)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			e.GET("/", func(c echo.Context) error {
+				cancel()
+				canceled = true
+				return c.NoContent(http.StatusOK)
+			})
+			serve(e, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+			if len(errs) == 0 {
+				t.Fatal("no measurements recorded after the request context was canceled")
+			}
+			for i, err := range errs {
+				if !errors.Is(err, tt.wantErr) || deadlines[i] != tt.wantDeadline {
+					t.Fatalf("recording context error = %v, deadline = %v, want %v and %v", err, deadlines[i], tt.wantErr, tt.wantDeadline)
+				}
+			}
+			if got := singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Value; got != 1 {
+				t.Fatalf("requests_total = %d, want 1", got)
+			}
+		})
+	}
+}
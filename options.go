@@ -0,0 +1,52 @@
+package otelmetricsecho
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Option configures the middleware created by New.
+type Option func(*MiddlewareConfig)
+
+// New creates the middleware from functional options.
+func New(opts ...Option) (echo.MiddlewareFunc, error) {
+	return newConfig(opts...).ToMiddleware()
+}
+
+func newConfig(opts ...Option) MiddlewareConfig {
+	var conf MiddlewareConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	return conf
+}
+
+// WithServiceName sets MiddlewareConfig.ServiceName.
+func WithServiceName(name string) Option {
+	return func(conf *MiddlewareConfig) {
+		conf.ServiceName = name
+	}
+}
+
+// WithMeterProvider sets MiddlewareConfig.MeterProvider.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(conf *MiddlewareConfig) {
+		conf.MeterProvider = provider
+	}
+}
+
+// WithDurationBuckets sets MiddlewareConfig.DurationBuckets.
+func WithDurationBuckets(buckets ...float64) Option {
+	return func(conf *MiddlewareConfig) {
+		conf.DurationBuckets = buckets
+	}
+}
+
+// WithSkipper sets MiddlewareConfig.Skipper.
+func WithSkipper(skipper middleware.Skipper) Option {
+	return func(conf *MiddlewareConfig) {
+		conf.Skipper = skipper
+	}
+}
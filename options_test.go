@@ -0,0 +1,54 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestNew(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	buckets := []float64{0.01, 0.1, 1}
+
+	mw, err := New(
+		WithServiceName("myapp"),
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		WithDurationBuckets(buckets...),
+		WithSkipper(SkipExactPaths("/health")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+	get(e, "/health")
+
+	metrics := collect(t, reader)
+	point := singleSum(t, metrics, metricHTTPRequestsTotal)
+	if point.Value != 1 {
+		t.Fatalf("requests_total = %d, want 1 as /health is skipped", point.Value)
+	}
+	assertAttr(t, point.Attributes, semconv.ServiceNameKey, attribute.StringValue("myapp"))
+
+	if got := singleHistogram(t, metrics, metricHTTPRequestDurationSeconds).Bounds; !slices.Equal(got, buckets) {
+		t.Fatalf("bounds = %v, want %v", got, buckets)
+	}
+}
+
+func TestNewError(t *testing.T) {
+	if _, err := New(WithMeterProvider(failingMeterProvider{})); err == nil {
+		t.Fatal("New succeeded, want instrument error")
+	}
+	if _, err := New(WithDurationBuckets(1, 0)); err == nil {
+		t.Fatal("New succeeded, want bucket error")
+	}
+}
@@ -0,0 +1,67 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+// NewOTLPMeterProvider creates a MeterProvider pushing metrics to an OTLP gRPC collector at endpoint with a
+// periodic reader. The endpoint is either "host:port" (TLS) or a URL such as "http://localhost:4317", where the
+// "http" scheme disables TLS. The resource carries the service name from opts. The returned function flushes
+// and shuts the provider down.
+func NewOTLPMeterProvider(ctx context.Context, endpoint string, opts ...Option) (metric.MeterProvider, func(context.Context) error, error) {
+	return newOTLPMeterProvider(ctx, endpoint, sdkmetric.DefaultTemporalitySelector, opts...)
+}
+
+// NewDeltaOTLPMeterProvider is like NewOTLPMeterProvider but exports counters and histograms with delta
+// temporality, as preferred by stateless backends. Up-down counters such as requests_in_flight stay
+// cumulative.
+func NewDeltaOTLPMeterProvider(ctx context.Context, endpoint string, opts ...Option) (metric.MeterProvider, func(context.Context) error, error) {
+	return newOTLPMeterProvider(ctx, endpoint, deltaTemporality, opts...)
+}
+
+func newOTLPMeterProvider(ctx context.Context, endpoint string, temporality sdkmetric.TemporalitySelector, opts ...Option) (metric.MeterProvider, func(context.Context) error, error) {
+	conf := newConfig(opts...)
+
+	endpointOpt := otlpmetricgrpc.WithEndpoint(endpoint)
+	if strings.Contains(endpoint, "://") {
+		endpointOpt = otlpmetricgrpc.WithEndpointURL(endpoint)
+	}
+
+	exporter, err := otlpmetricgrpc.New(ctx, endpointOpt, otlpmetricgrpc.WithTemporalitySelector(temporality))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(conf.serviceName())),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+
+	return provider, provider.Shutdown, nil
+}
+
+// deltaTemporality selects delta temporality for all instruments but up-down counters
+func deltaTemporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	switch kind {
+	case sdkmetric.InstrumentKindUpDownCounter, sdkmetric.InstrumentKindObservableUpDownCounter:
+		return metricdata.CumulativeTemporality
+	default:
+		return metricdata.DeltaTemporality
+	}
+}
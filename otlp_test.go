@@ -0,0 +1,154 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+// testCollector is an OTLP gRPC metrics collector keeping the exported resource metrics
+type testCollector struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+
+	mu      sync.Mutex
+	metrics []*metricpb.ResourceMetrics
+}
+
+func (c *testCollector) Export(_ context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	c.mu.Lock()
+	c.metrics = append(c.metrics, req.ResourceMetrics...)
+	c.mu.Unlock()
+
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+// exported returns the exported metrics keyed by name
+func (c *testCollector) exported() map[string]*metricpb.Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics := make(map[string]*metricpb.Metric)
+	for _, rm := range c.metrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				metrics[m.Name] = m
+			}
+		}
+	}
+
+	return metrics
+}
+
+// startCollector starts a testCollector and returns it with its "http://host:port" endpoint
+func startCollector(t *testing.T) (*testCollector, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &testCollector{}
+	server := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(server, collector)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	return collector, "http://" + listener.Addr().String()
+}
+
+func TestNewOTLPMeterProvider(t *testing.T) {
+	collector, endpoint := startCollector(t)
+
+	provider, shutdown, err := NewOTLPMeterProvider(context.Background(), endpoint, WithServiceName("myapp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(NewMiddlewareWithConfig(MiddlewareConfig{MeterProvider: provider}))
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := collector.exported()
+	for _, name := range requestMetrics {
+		if _, ok := metrics[name]; !ok {
+			t.Errorf("metric %q not exported", name)
+		}
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if len(collector.metrics) == 0 {
+		t.Fatal("nothing exported")
+	}
+	var service string
+	for _, kv := range collector.metrics[0].Resource.Attributes {
+		if kv.Key == "service.name" {
+			service = kv.Value.GetStringValue()
+		}
+	}
+	if service != "myapp" {
+		t.Fatalf("resource service.name = %q, want myapp", service)
+	}
+}
+
+func TestDeltaTemporality(t *testing.T) {
+	for kind, want := range map[sdkmetric.InstrumentKind]metricdata.Temporality{
+		sdkmetric.InstrumentKindCounter:                 metricdata.DeltaTemporality,
+		sdkmetric.InstrumentKindHistogram:               metricdata.DeltaTemporality,
+		sdkmetric.InstrumentKindObservableCounter:       metricdata.DeltaTemporality,
+		sdkmetric.InstrumentKindUpDownCounter:           metricdata.CumulativeTemporality,
+		sdkmetric.InstrumentKindObservableUpDownCounter: metricdata.CumulativeTemporality,
+	} {
+		if got := deltaTemporality(kind); got != want {
+			t.Errorf("deltaTemporality(%v) = %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestNewDeltaOTLPMeterProvider(t *testing.T) {
+	collector, endpoint := startCollector(t)
+
+	provider, shutdown, err := NewDeltaOTLPMeterProvider(context.Background(), endpoint, WithServiceName("myapp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(NewMiddlewareWithConfig(MiddlewareConfig{MeterProvider: provider}))
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := collector.exported()
+	delta := metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	if m, ok := metrics[metricHTTPRequestsTotal]; !ok || m.GetSum().GetAggregationTemporality() != delta {
+		t.Errorf("requests_total = %v, want a delta sum", m)
+	}
+	for _, name := range []string{metricHTTPRequestDurationSeconds, metricHTTPRequestSizeBytes, metricHTTPResponseSizeBytes} {
+		if m, ok := metrics[name]; !ok || m.GetHistogram().GetAggregationTemporality() != delta {
+			t.Errorf("%s = %v, want a delta histogram", name, m)
+		}
+	}
+	cumulative := metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	if m, ok := metrics[metricHTTPRequestsInFlight]; !ok || m.GetSum().GetAggregationTemporality() != cumulative {
+		t.Errorf("requests_in_flight = %v, want a cumulative sum", m)
+	}
+}
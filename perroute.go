@@ -0,0 +1,101 @@
+package otelmetricsecho
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+// RouteConfig overrides the middleware configuration for a single route, see MiddlewareConfig.PerRoute.
+type RouteConfig struct {
+	// DisableRequestCount skips requests_total for the route.
+	DisableRequestCount bool
+	// DisableDuration skips the request duration histogram for the route.
+	DisableDuration bool
+	// DisableRequestSize skips request_size_bytes for the route.
+	DisableRequestSize bool
+	// DisableResponseSize skips response_size_bytes for the route.
+	DisableResponseSize bool
+	// Attributes are added to every metric recorded for the route.
+	Attributes []attribute.KeyValue
+	// DurationBuckets overrides the bucket boundaries of the request duration histogram for the route.
+	//
+	// Bucket boundaries belong to an instrument rather than to individual measurements, so histograms with
+	// overridden buckets are created on a separate meter whose instrumentation scope carries the http.route
+	// attribute. Their data points are exported in that scope, next to the histograms of the other routes.
+	DurationBuckets []float64
+	// RequestSizeBuckets overrides the bucket boundaries of request_size_bytes for the route, see
+	// DurationBuckets.
+	RequestSizeBuckets []float64
+	// ResponseSizeBuckets overrides the bucket boundaries of response_size_bytes for the route, see
+	// DurationBuckets.
+	ResponseSizeBuckets []float64
+}
+
+func (r RouteConfig) overridesBuckets() bool {
+	return len(r.DurationBuckets) > 0 || len(r.RequestSizeBuckets) > 0 || len(r.ResponseSizeBuckets) > 0
+}
+
+// routeHistograms are the histograms a request is recorded in. Disabled histograms are nil.
+type routeHistograms struct {
+	duration     metric.Float64Histogram
+	perMethod    *methodHistograms
+	requestSize  metric.Float64Histogram
+	responseSize metric.Float64Histogram
+}
+
+// newRouteHistograms creates the histograms of a route with bucket overrides. Histograms without
+// overridden buckets are taken from defaults.
+func newRouteHistograms(provider metric.MeterProvider, conf MiddlewareConfig, route string, routeConf RouteConfig, defaults routeHistograms) (routeHistograms, []error) {
+	meter := provider.Meter(
+		conf.MeterName,
+		metric.WithInstrumentationVersion(Version),
+		metric.WithInstrumentationAttributes(semconv.HTTPRoute(route)),
+	)
+	histograms := defaults
+
+	var (
+		err  error
+		errs []error
+	)
+
+	if defaults.duration != nil && len(routeConf.DurationBuckets) > 0 {
+		histograms.duration, err = meter.Float64Histogram(
+			conf.metricName(conf.DurationUnit.metricName()),
+			conf.description(conf.metricName(conf.DurationUnit.metricName()), "The HTTP request latencies."),
+			metric.WithExplicitBucketBoundaries(routeConf.DurationBuckets...),
+			metric.WithUnit(conf.DurationUnit.unit()),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(conf.DurationUnit.metricName()), err)
+	}
+
+	if defaults.perMethod != nil && len(routeConf.DurationBuckets) > 0 {
+		methodConf := conf
+		methodConf.DurationBuckets = routeConf.DurationBuckets
+		var methodErrs []error
+		histograms.perMethod, methodErrs = newMethodHistograms(meter, methodConf)
+		errs = append(errs, methodErrs...)
+	}
+
+	if defaults.requestSize != nil && len(routeConf.RequestSizeBuckets) > 0 {
+		histograms.requestSize, err = meter.Float64Histogram(
+			conf.metricName(metricHTTPRequestSizeBytes),
+			conf.description(conf.metricName(metricHTTPRequestSizeBytes), "The HTTP request sizes in bytes."),
+			metric.WithExplicitBucketBoundaries(routeConf.RequestSizeBuckets...),
+			metric.WithUnit("By"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPRequestSizeBytes), err)
+	}
+
+	if defaults.responseSize != nil && len(routeConf.ResponseSizeBuckets) > 0 {
+		histograms.responseSize, err = meter.Float64Histogram(
+			conf.metricName(metricHTTPResponseSizeBytes),
+			conf.description(conf.metricName(metricHTTPResponseSizeBytes), "The HTTP response sizes in bytes."),
+			metric.WithExplicitBucketBoundaries(routeConf.ResponseSizeBuckets...),
+			metric.WithUnit("By"),
+		)
+		errs = appendInstrumentErr(errs, conf.metricName(metricHTTPResponseSizeBytes), err)
+	}
+
+	return histograms, errs
+}
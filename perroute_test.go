@@ -0,0 +1,132 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+// routeHistogramPoints returns the data points of histogram name by http.route across all scopes
+func routeHistogramPoints(t *testing.T, reader sdkmetric.Reader, name string) map[string]metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	points := make(map[string]metricdata.HistogramDataPoint[float64])
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+				route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+				if _, ok := points[route.AsString()]; ok {
+					t.Fatalf("%s recorded for %s in several scopes", name, route.AsString())
+				}
+				points[route.AsString()] = point
+			}
+		}
+	}
+
+	return points
+}
+
+func TestPerRoute(t *testing.T) {
+	fastBuckets := []float64{0.001, 0.005, 0.01}
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		PerRoute: map[string]RouteConfig{
+			"/fast":   {DurationBuckets: fastBuckets},
+			"/upload": {DisableRequestSize: true, DisableResponseSize: true},
+			"/tagged": {DisableRequestCount: true, Attributes: []attribute.KeyValue{attribute.String("team", "search")}},
+		},
+	})
+	for _, route := range []string{"/fast", "/upload", "/tagged", "/other"} {
+		e.POST(route, func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+		serve(e, httptest.NewRequest(http.MethodPost, route, strings.NewReader("body")))
+	}
+
+	durations := routeHistogramPoints(t, reader, metricHTTPRequestDurationSeconds)
+	if len(durations) != 4 {
+		t.Fatalf("request_duration_seconds recorded for %d routes, want 4", len(durations))
+	}
+	for route, point := range durations {
+		want := durationBuckets
+		if route == "/fast" {
+			want = fastBuckets
+		}
+		if !slices.Equal(point.Bounds, want) {
+			t.Errorf("%s request_duration_seconds bounds = %v, want %v", route, point.Bounds, want)
+		}
+	}
+
+	for _, name := range []string{metricHTTPRequestSizeBytes, metricHTTPResponseSizeBytes} {
+		points := routeHistogramPoints(t, reader, name)
+		if _, ok := points["/upload"]; ok {
+			t.Errorf("%s recorded for /upload although disabled", name)
+		}
+		if len(points) != 3 {
+			t.Errorf("%s recorded for %d routes, want 3", name, len(points))
+		}
+	}
+
+	counts := routes(t, reader)
+	if _, ok := counts["/tagged"]; ok {
+		t.Error("requests_total recorded for /tagged although disabled")
+	}
+	if len(counts) != 3 {
+		t.Errorf("requests_total = %v, want every route but /tagged", counts)
+	}
+	for route, point := range durations {
+		if route == "/tagged" {
+			assertAttr(t, point.Attributes, "team", attribute.StringValue("search"))
+		} else {
+			assertNoAttr(t, point.Attributes, "team")
+		}
+	}
+}
+
+func TestPerRouteBucketScope(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		PerRoute: map[string]RouteConfig{"/upload": {RequestSizeBuckets: []float64{1 << 20, 1 << 30}}},
+	})
+	e.POST("/upload", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	serve(e, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("body")))
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		route, routed := sm.Scope.Attributes.Value(semconv.HTTPRouteKey)
+		for _, m := range sm.Metrics {
+			if m.Name == metricHTTPRequestSizeBytes && (!routed || route.AsString() != "/upload") {
+				t.Errorf("request_size_bytes exported in scope %v, want the /upload scope", sm.Scope)
+			}
+			if m.Name == metricHTTPResponseSizeBytes && routed {
+				t.Errorf("response_size_bytes exported in the route scope although not overridden")
+			}
+		}
+	}
+}
+
+func TestPerRouteInvalidBuckets(t *testing.T) {
+	_, err := MiddlewareConfig{
+		MeterProvider: sdkmetric.NewMeterProvider(),
+		PerRoute:      map[string]RouteConfig{"/fast": {DurationBuckets: []float64{2, 1}}},
+	}.ToMiddleware()
+	if err == nil || !strings.Contains(err.Error(), "/fast") {
+		t.Fatalf("error = %v, want the invalid /fast buckets reported", err)
+	}
+}
@@ -0,0 +1,33 @@
+package otelmetricsecho
+
+import (
+	"github.com/labstack/echo/v4"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// NewPrometheusExporter creates a Prometheus exporter and a MeterProvider reading from it. The exporter
+// registers with the default Prometheus registerer unless opts set another one with prometheus.WithRegisterer,
+// e.g. a registry per provider so that several providers can be scraped separately. Pass the provider to
+// MiddlewareConfig.MeterProvider and shut it down on exit.
+func NewPrometheusExporter(opts ...prometheus.Option) (*prometheus.Exporter, *sdkmetric.MeterProvider, error) {
+	exporter, err := prometheus.New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return exporter, sdkmetric.NewMeterProvider(sdkmetric.WithReader(exporter)), nil
+}
+
+// RegisterMetricsHandler mounts the default Prometheus registry handler on path.
+func RegisterMetricsHandler(e *echo.Echo, path string) {
+	e.GET(path, echo.WrapHandler(promhttp.Handler()))
+}
+
+// RegisterMetricsHandlerFor mounts a handler serving the metrics of gatherer on path, e.g. of the registry
+// passed to NewPrometheusExporter with prometheus.WithRegisterer.
+func RegisterMetricsHandlerFor(e *echo.Echo, path string, gatherer promclient.Gatherer) {
+	e.GET(path, echo.WrapHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})))
+}
@@ -0,0 +1,85 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+)
+
+func TestPrometheusScrape(t *testing.T) {
+	registry := promclient.NewRegistry()
+	_, provider, err := NewPrometheusExporter(prometheus.WithRegisterer(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	e := echo.New()
+	e.Use(NewMiddlewareWithConfig(MiddlewareConfig{MeterProvider: provider}))
+	e.GET("/hello", func(c echo.Context) error { return c.String(http.StatusOK, "Hello, World!") })
+	RegisterMetricsHandlerFor(e, "/metrics", registry)
+
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, family := range []string{
+		"# TYPE requests_total counter",
+		"# TYPE request_duration_seconds histogram",
+		"# TYPE request_size_bytes histogram",
+		"# TYPE response_size_bytes histogram",
+	} {
+		if !strings.Contains(string(body), family) {
+			t.Errorf("scrape does not contain %q:\n%s", family, body)
+		}
+	}
+	if want := `http_route="/hello"`; !strings.Contains(string(body), want) {
+		t.Errorf("scrape does not contain %s:\n%s", want, body)
+	}
+}
+
+func TestNewPrometheusExporterRegistries(t *testing.T) {
+	for _, name := range []string{"first", "second"} {
+		registry := promclient.NewRegistry()
+		_, provider, err := NewPrometheusExporter(prometheus.WithRegisterer(registry))
+		if err != nil {
+			t.Fatalf("%s exporter: %v", name, err)
+		}
+
+		e := echo.New()
+		e.Use(NewMiddlewareWithConfig(MiddlewareConfig{MeterProvider: provider, ServiceName: name}))
+		e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		RegisterMetricsHandlerFor(e, "/metrics", registry)
+		get(e, "/")
+
+		body := get(e, "/metrics").Body.String()
+		if want := `service_name="` + name + `"`; !strings.Contains(body, want) {
+			t.Errorf("%s scrape does not contain %s:\n%s", name, want, body)
+		}
+		if err := provider.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
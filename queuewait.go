@@ -0,0 +1,43 @@
+package otelmetricsecho
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxQueueWait bounds the recorded queue wait; longer waits come from clock skew or bogus headers
+const maxQueueWait = time.Hour
+
+// parseRequestStart parses a request start header such as X-Request-Start, set by load balancers as a unix
+// timestamp in seconds, milliseconds, microseconds or nanoseconds, optionally prefixed with "t=". The unit
+// is inferred from the magnitude.
+func parseRequestStart(value string) (time.Time, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "t=")
+	ts, err := strconv.ParseFloat(value, 64)
+	if err != nil || ts <= 0 || math.IsInf(ts, 0) {
+		return time.Time{}, false
+	}
+
+	var nanos float64
+	switch {
+	case ts >= 1e18:
+		nanos = ts
+	case ts >= 1e15:
+		nanos = ts * 1e3
+	case ts >= 1e12:
+		nanos = ts * 1e6
+	case ts >= 1e9:
+		nanos = ts * 1e9
+	default:
+		return time.Time{}, false
+	}
+
+	// float64(math.MaxInt64) rounds up to 2^63, which already overflows int64
+	if nanos >= math.MaxInt64 {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, int64(nanos)), true
+}
@@ -0,0 +1,67 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestParseRequestStart(t *testing.T) {
+	want := time.Unix(1700000000, 500000000)
+	for _, value := range []string{"1700000000.5", "t=1700000000500", "1700000000500000", " 1700000000500000000 "} {
+		got, ok := parseRequestStart(value)
+		if !ok || !got.Equal(want) {
+			t.Errorf("parseRequestStart(%q) = %v, %v, want %v", value, got, ok, want)
+		}
+	}
+	for _, value := range []string{"", "abc", "-1700000000", "0", "12345", "+Inf", "1e25", "9.3e18"} {
+		if got, ok := parseRequestStart(value); ok {
+			t.Errorf("parseRequestStart(%q) = %v, want invalid", value, got)
+		}
+	}
+}
+
+func TestQueueWait(t *testing.T) {
+	now := time.Unix(1700000001, 0)
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		QueueWaitHeader: "X-Request-Start",
+		TimeNow:         func() time.Time { return now },
+	})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	// valid, malformed, in the future, overflowing int64 nanoseconds, older than maxQueueWait, missing
+	for _, header := range []string{"t=1700000000500", "malformed", "1700000002000", "1e25", "9.3e18", "1000000000", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("X-Request-Start", header)
+		}
+		serve(e, req)
+	}
+
+	metrics := collect(t, reader)
+	point := singleHistogram(t, metrics, metricQueueWaitSeconds)
+	if point.Count != 1 || point.Sum != 0.5 {
+		t.Fatalf("queue_wait_seconds count = %d, sum = %v, want 1 and 0.5", point.Count, point.Sum)
+	}
+	assertAttr(t, point.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/"))
+	assertAttr(t, point.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+	if got := singleSum(t, metrics, metricHTTPRequestsTotal).Value; got != 7 {
+		t.Fatalf("requests_total = %d, want 7", got)
+	}
+}
+
+func TestQueueWaitDisabled(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-Start", "t=1700000000500")
+	serve(e, req)
+
+	if _, ok := collect(t, reader)[metricQueueWaitSeconds]; ok {
+		t.Fatal("queue_wait_seconds recorded without QueueWaitHeader")
+	}
+}
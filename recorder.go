@@ -0,0 +1,115 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// Measurement is a single measurement captured by a TestRecorder.
+type Measurement struct {
+	// Name is the instrument name, e.g. requests_total.
+	Name       string
+	Value      float64
+	Attributes attribute.Set
+}
+
+// TestRecorder captures the measurements of the synchronous instruments of the middleware in memory, for
+// testing code using the middleware without setting up an SDK. Observable instruments are not captured.
+// The zero value is ready to use.
+type TestRecorder struct {
+	embedded.MeterProvider
+
+	mu           sync.Mutex
+	measurements []Measurement
+}
+
+// NewMiddlewareWithRecorder is like NewMiddlewareWithConfig but records into recorder, replacing
+// config.MeterProvider.
+func NewMiddlewareWithRecorder(config MiddlewareConfig, recorder *TestRecorder) echo.MiddlewareFunc {
+	config.MeterProvider = recorder
+	return NewMiddlewareWithConfig(config)
+}
+
+// Measurements returns the captured measurements in the order they were recorded.
+func (r *TestRecorder) Measurements() []Measurement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.measurements)
+}
+
+// Reset discards the captured measurements.
+func (r *TestRecorder) Reset() {
+	r.mu.Lock()
+	r.measurements = nil
+	r.mu.Unlock()
+}
+
+// Meter implements metric.MeterProvider.
+func (r *TestRecorder) Meter(string, ...metric.MeterOption) metric.Meter {
+	return recorderMeter{recorder: r}
+}
+
+func (r *TestRecorder) record(name string, value float64, attrs attribute.Set) {
+	r.mu.Lock()
+	r.measurements = append(r.measurements, Measurement{Name: name, Value: value, Attributes: attrs})
+	r.mu.Unlock()
+}
+
+type recorderMeter struct {
+	noop.Meter
+	recorder *TestRecorder
+}
+
+func (m recorderMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return recorderInt64{recorder: m.recorder, name: name}, nil
+}
+
+func (m recorderMeter) Int64UpDownCounter(name string, _ ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	return recorderInt64{recorder: m.recorder, name: name}, nil
+}
+
+func (m recorderMeter) Float64Histogram(name string, _ ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return recorderFloat64Histogram{recorder: m.recorder, name: name}, nil
+}
+
+// recorderInt64 captures counter and up-down counter additions
+type recorderInt64 struct {
+	embedded.Int64Counter
+	embedded.Int64UpDownCounter
+
+	recorder *TestRecorder
+	name     string
+}
+
+func (i recorderInt64) Add(_ context.Context, incr int64, opts ...metric.AddOption) {
+	i.recorder.record(i.name, float64(incr), metric.NewAddConfig(opts).Attributes())
+}
+
+// Enabled reports that measurements are always captured
+func (i recorderInt64) Enabled(context.Context) bool {
+	return true
+}
+
+type recorderFloat64Histogram struct {
+	embedded.Float64Histogram
+
+	recorder *TestRecorder
+	name     string
+}
+
+func (h recorderFloat64Histogram) Record(_ context.Context, value float64, opts ...metric.RecordOption) {
+	h.recorder.record(h.name, value, metric.NewRecordConfig(opts).Attributes())
+}
+
+// Enabled reports that measurements are always captured
+func (h recorderFloat64Histogram) Enabled(context.Context) bool {
+	return true
+}
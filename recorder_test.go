@@ -0,0 +1,51 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestMiddlewareWithRecorder(t *testing.T) {
+	var recorder TestRecorder
+	e := echo.New()
+	e.Use(NewMiddlewareWithRecorder(MiddlewareConfig{TimeNow: fakeClock(2 * time.Second)}, &recorder))
+	e.GET("/users/:id", func(c echo.Context) error { return c.String(http.StatusCreated, "ok") })
+	serve(e, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+	values := make(map[string][]float64)
+	for _, m := range recorder.Measurements() {
+		values[m.Name] = append(values[m.Name], m.Value)
+		if m.Name != metricHTTPRequestsTotal {
+			continue
+		}
+		assertAttr(t, m.Attributes, semconv.HTTPRouteKey, attribute.StringValue("/users/:id"))
+		assertAttr(t, m.Attributes, semconv.HTTPRequestMethodKey, attribute.StringValue(http.MethodGet))
+		assertAttr(t, m.Attributes, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusCreated))
+	}
+	if got := values[metricHTTPRequestsTotal]; len(got) != 1 || got[0] != 1 {
+		t.Fatalf("requests_total = %v, want [1]", got)
+	}
+	if got := values[metricHTTPRequestDurationSeconds]; len(got) != 1 || got[0] != 2 {
+		t.Fatalf("request_duration_seconds = %v, want [2]", got)
+	}
+	if got := values[metricHTTPResponseSizeBytes]; len(got) != 1 || got[0] != 2 {
+		t.Fatalf("response_size_bytes = %v, want [2]", got)
+	}
+
+	measurements := recorder.Measurements()
+	measurements[0].Name = "changed"
+	if recorder.Measurements()[0].Name == "changed" {
+		t.Fatal("Measurements returned the recorder's slice")
+	}
+
+	recorder.Reset()
+	if got := recorder.Measurements(); len(got) != 0 {
+		t.Fatalf("Measurements after Reset = %v, want none", got)
+	}
+}
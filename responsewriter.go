@@ -0,0 +1,39 @@
+package otelmetricsecho
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// countingResponseWriter counts bytes written to the wrapped writer, including writes bypassing
+// echo.Response
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *countingResponseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+// FlushError flushes the wrapped writer, returning http.ErrNotSupported when it can not flush. It is
+// preferred over Flush by http.ResponseController, so the error reaches echo.Response.
+func (w *countingResponseWriter) FlushError() error {
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,94 @@
+package otelmetricsecho
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestCountResponseBytes(t *testing.T) {
+	const body = "written to the raw writer"
+	handler := func(c echo.Context) error {
+		// bypasses echo.Response, so its Size stays 0
+		w := c.Response().Writer
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(body))
+		return err
+	}
+
+	e, reader := newTestEcho(t, MiddlewareConfig{CountResponseBytes: true})
+	e.GET("/", handler)
+	e.GET("/echo", func(c echo.Context) error { return c.String(http.StatusOK, body) })
+	get(e, "/")
+	get(e, "/echo")
+
+	points := routeHistogramPoints(t, reader, metricHTTPResponseSizeBytes)
+	if len(points) != 2 {
+		t.Fatalf("response_size_bytes recorded for %d routes, want 2", len(points))
+	}
+	for route, point := range points {
+		if point.Count != 1 || point.Sum != float64(len(body)) {
+			t.Errorf("%s response_size_bytes count = %d sum = %v, want 1 and %d", route, point.Count, point.Sum, len(body))
+		}
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	e.GET("/", handler)
+	get(e, "/")
+	if got := singleHistogram(t, collect(t, reader), metricHTTPResponseSizeBytes).Sum; got >= float64(len(body)) {
+		t.Fatalf("response_size_bytes sum = %v without CountResponseBytes, want undercounted", got)
+	}
+}
+
+func TestCountingResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &countingResponseWriter{ResponseWriter: rec}
+	_, _ = w.Write([]byte("abc"))
+	_, _ = w.Write([]byte("de"))
+	w.Flush()
+
+	if w.n != 5 || rec.Body.String() != "abcde" || !rec.Flushed {
+		t.Fatalf("counted %d bytes, wrote %q, flushed %t", w.n, rec.Body.String(), rec.Flushed)
+	}
+	if w.Unwrap() != rec {
+		t.Fatal("Unwrap does not return the wrapped writer")
+	}
+}
+
+// plainResponseWriter implements http.ResponseWriter only, so it can not be flushed
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestCountingResponseWriterFlushNotSupported(t *testing.T) {
+	w := &countingResponseWriter{ResponseWriter: plainResponseWriter{httptest.NewRecorder()}}
+	if err := w.FlushError(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("FlushError = %v, want http.ErrNotSupported", err)
+	}
+	if err := http.NewResponseController(w).Flush(); !errors.Is(err, http.ErrNotSupported) {
+		t.Fatalf("ResponseController.Flush = %v, want http.ErrNotSupported", err)
+	}
+
+	flushable := &countingResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	if err := http.NewResponseController(flushable).Flush(); err != nil {
+		t.Fatalf("ResponseController.Flush = %v, want nil", err)
+	}
+}
+
+func TestCountResponseBytesFlushNotSupported(t *testing.T) {
+	e, _ := newTestEcho(t, MiddlewareConfig{CountResponseBytes: true})
+	var recovered any
+	e.GET("/", func(c echo.Context) error {
+		defer func() { recovered = recover() }()
+		c.Response().Flush()
+		return nil
+	})
+	e.ServeHTTP(plainResponseWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if err, ok := recovered.(error); !ok || err.Error() != "response writer flushing is not supported" {
+		t.Fatalf("Flush on a writer that can not flush recovered %v, want Echo's flushing error", recovered)
+	}
+}
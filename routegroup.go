@@ -0,0 +1,21 @@
+package otelmetricsecho
+
+import "strings"
+
+// routeGroup returns the group prefix of a route template: the segments before the first dynamic segment
+// (a ":param" or "*"), without the last one naming the resource. For example "/api/v1/users/:id" and
+// "/api/v1/health" both belong to "/api/v1", and "/users/:id" to "/".
+func routeGroup(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.Contains(segment, "*") {
+			segments = segments[:i]
+			break
+		}
+	}
+	if len(segments) > 0 {
+		segments = segments[:len(segments)-1]
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,76 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestRouteGroup(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/users/:id": "/api/v1",
+		"/api/v1/health":    "/api/v1",
+		"/api/v1/files/*":   "/api/v1",
+		"/users/:id":        "/",
+		"/health":           "/",
+		"/":                 "/",
+	}
+	for path, want := range tests {
+		if got := routeGroup(path); got != want {
+			t.Errorf("routeGroup(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// routeGroups returns requests_total by http.route.group, "" for requests without the attribute
+func routeGroups(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	t.Helper()
+
+	groups := make(map[string]int64)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		group, _ := point.Attributes.Value(attrRouteGroup)
+		groups[group.AsString()] += point.Value
+	}
+
+	return groups
+}
+
+func TestRouteGroupAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{RouteGroupAttribute: true})
+	v1 := e.Group("/api/v1")
+	v1.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	v1.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/status", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/api/v1/users/1")
+	get(e, "/api/v1/health")
+	get(e, "/status")
+	get(e, "/missing")
+
+	if got, want := routeGroups(t, reader), map[string]int64{"/api/v1": 2, "/": 1, "": 1}; !maps.Equal(got, want) {
+		t.Fatalf("http.route.group = %v, want %v", got, want)
+	}
+}
+
+func TestRouteGroupFunc(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{
+		RouteGroupAttribute: true,
+		RouteGroupFunc: func(c echo.Context) string {
+			if strings.HasPrefix(c.Path(), "/admin") {
+				return "admin"
+			}
+			return ""
+		},
+	})
+	e.GET("/admin/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/api/v1/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/admin/users/1")
+	get(e, "/api/v1/users/1")
+
+	if got, want := routeGroups(t, reader), map[string]int64{"admin": 1, "": 1}; !maps.Equal(got, want) {
+		t.Fatalf("http.route.group = %v, want %v", got, want)
+	}
+}
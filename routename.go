@@ -0,0 +1,118 @@
+package otelmetricsecho
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// routeNames resolves names of matched routes. Routes are cached by method and path; the name is read from
+// the cached route on every lookup as it may be changed after the route is registered.
+type routeNames struct {
+	routes   sync.Map // method+path -> *echo.Route
+	handlers *HandlerNames
+}
+
+// name returns name of the route matched by c, or empty string when it can not be resolved
+func (n *routeNames) name(c echo.Context) string {
+	key := c.Request().Method + c.Path()
+	if route, ok := n.routes.Load(key); ok {
+		return route.(*echo.Route).Name
+	}
+
+	for _, route := range c.Echo().Routes() {
+		if route.Method+route.Path == key {
+			n.routes.Store(key, route)
+			return route.Name
+		}
+	}
+
+	return ""
+}
+
+// routeName returns the explicitly set name of the route matched by c, or empty string when the route has
+// no name or keeps the name Echo derived from its handler function
+func (n *routeNames) routeName(c echo.Context) string {
+	name := n.name(c)
+	if handler, ok := n.handlers.name(c); ok {
+		if name == handler {
+			return ""
+		}
+		return name
+	}
+	if isHandlerFuncName(name) {
+		return ""
+	}
+
+	return name
+}
+
+// handlerName returns the name of the handler function of the route matched by c, or empty string when it
+// is not known, e.g. for a route renamed explicitly and not tracked by HandlerNames
+func (n *routeNames) handlerName(c echo.Context) string {
+	if handler, ok := n.handlers.name(c); ok {
+		return handler
+	}
+	if name := n.name(c); isHandlerFuncName(name) {
+		return name
+	}
+
+	return ""
+}
+
+// HandlerNames tracks the handler functions of the routes added to an Echo instance. The middleware can not
+// resolve them from the request as c.Handler() returns the wrapper Echo registers in its router, so without
+// HandlerNames handler names are derived from the route names Echo gives by default.
+type HandlerNames struct {
+	names sync.Map // method+path -> handler function name
+}
+
+// NewHandlerNames returns HandlerNames tracking the routes added to e from now on; create it before
+// registering routes. It sets e.OnAddRouteHandler, calling the previously set function.
+func NewHandlerNames(e *echo.Echo) *HandlerNames {
+	h := &HandlerNames{}
+	next := e.OnAddRouteHandler
+	e.OnAddRouteHandler = func(host string, route echo.Route, handler echo.HandlerFunc, middleware []echo.MiddlewareFunc) {
+		if handler != nil {
+			h.names.Store(route.Method+route.Path, runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name())
+		}
+		if next != nil {
+			next(host, route, handler, middleware)
+		}
+	}
+
+	return h
+}
+
+// name returns the handler function name of the route matched by c, if tracked
+func (h *HandlerNames) name(c echo.Context) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	name, ok := h.names.Load(c.Request().Method + c.Path())
+	if !ok {
+		return "", false
+	}
+
+	return name.(string), true
+}
+
+// isHandlerFuncName reports whether name has the form of the names Echo gives routes by default, the
+// qualified name of the handler function, e.g. "github.com/org/app.listUsers" or "main.(*API).list-fm"
+func isHandlerFuncName(name string) bool {
+	if strings.ContainsAny(name, " \t") {
+		return false
+	}
+
+	slash := strings.LastIndexByte(name, '/')
+	last := name[slash+1:]
+	dot := strings.IndexByte(last, '.')
+	if dot <= 0 || dot == len(last)-1 {
+		return false
+	}
+
+	return slash > 0 || last[:dot] == "main"
+}
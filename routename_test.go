@@ -0,0 +1,122 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func TestUseRouteName(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{UseRouteName: true})
+	e.GET("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) }).Name = "get-user"
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) }).Name = ""
+	e.GET("/users", listUsers)
+	e.GET("/status", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/users/1")
+	get(e, "/users/2")
+	get(e, "/health")
+	get(e, "/users")
+	get(e, "/status")
+	get(e, "/missing")
+
+	want := map[string]int64{"get-user": 2, "/health": 1, "/users": 1, "/status": 1, "/missing": 1}
+	if got := routes(t, reader); !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func TestIsHandlerFuncName(t *testing.T) {
+	tests := map[string]bool{
+		"github.com/org/app.listUsers":               true,
+		"github.com/org/app.TestRoutes.func1":        true,
+		"github.com/org/app/api.(*Handlers).List-fm": true,
+		"main.listUsers":                             true,
+		"":                                           false,
+		"get-user":                                   false,
+		"users.get":                                  false,
+		"/users/:id":                                 false,
+		"list users.v1/x.y":                          false,
+	}
+	for name, want := range tests {
+		if got := isHandlerFuncName(name); got != want {
+			t.Errorf("isHandlerFuncName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func listUsers(c echo.Context) error { return c.NoContent(http.StatusOK) }
+
+func TestHandlerNameAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{HandlerNameAttribute: true})
+	e.GET("/users", listUsers)
+	get(e, "/users")
+	get(e, "/missing")
+
+	names := make(map[string]string)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		name, _ := point.Attributes.Value(semconv.CodeFunctionKey)
+		names[route.AsString()] = name.AsString()
+	}
+	want := map[string]string{
+		"/users":   "github.com/overtonx/otel-metrics-echo.listUsers",
+		"/missing": "",
+	}
+	if !maps.Equal(names, want) {
+		t.Fatalf("code.function = %v, want %v", names, want)
+	}
+}
+
+func TestHandlerNames(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	e := echo.New()
+	var added []string
+	e.OnAddRouteHandler = func(_ string, route echo.Route, _ echo.HandlerFunc, _ []echo.MiddlewareFunc) {
+		added = append(added, route.Path)
+	}
+	handlers := NewHandlerNames(e)
+	mw, err := MiddlewareConfig{
+		MeterProvider:        sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		HandlerNameAttribute: true,
+		UseRouteName:         true,
+		HandlerNames:         handlers,
+	}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Use(mw)
+	e.GET("/users", listUsers).Name = "list-users"
+	e.GET("/users/all", listUsers)
+	get(e, "/users")
+	get(e, "/users/all")
+
+	names := make(map[string]string)
+	for _, point := range sumPoints(t, collect(t, reader), metricHTTPRequestsTotal) {
+		route, _ := point.Attributes.Value(semconv.HTTPRouteKey)
+		name, _ := point.Attributes.Value(semconv.CodeFunctionKey)
+		names[route.AsString()] = name.AsString()
+	}
+	want := map[string]string{
+		"list-users": "github.com/overtonx/otel-metrics-echo.listUsers",
+		"/users/all": "github.com/overtonx/otel-metrics-echo.listUsers",
+	}
+	if !maps.Equal(names, want) {
+		t.Fatalf("code.function by http.route = %v, want %v", names, want)
+	}
+	if want := []string{"/users", "/users/all"}; !slices.Equal(added, want) {
+		t.Fatalf("previous OnAddRouteHandler saw %v, want %v", added, want)
+	}
+}
+
+func TestHandlerNameAttributeNamedRoute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{HandlerNameAttribute: true})
+	e.GET("/users", listUsers).Name = "list-users"
+	get(e, "/users")
+
+	assertNoAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, semconv.CodeFunctionKey)
+}
@@ -0,0 +1,46 @@
+package otelmetricsecho
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// SkipPaths returns a Skipper skipping requests whose path is one of prefixes or lies under it, matching
+// whole path segments: "/internal" skips "/internal" and "/internal/debug" but not "/internals".
+func SkipPaths(prefixes ...string) middleware.Skipper {
+	trimmed := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		trimmed = append(trimmed, trimTrailingSlash(prefix))
+	}
+
+	return func(c echo.Context) bool {
+		path := trimTrailingSlash(c.Request().URL.Path)
+		for _, prefix := range trimmed {
+			if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// SkipExactPaths returns a Skipper skipping requests whose path equals one of paths. A trailing slash is
+// ignored on both sides, so "/health" also skips "/health/".
+func SkipExactPaths(paths ...string) middleware.Skipper {
+	set := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		set[trimTrailingSlash(path)] = struct{}{}
+	}
+
+	return func(c echo.Context) bool {
+		_, ok := set[trimTrailingSlash(c.Request().URL.Path)]
+		return ok
+	}
+}
+
+func trimTrailingSlash(path string) string {
+	return strings.TrimRight(path, "/")
+}
@@ -0,0 +1,89 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func skips(skipper middleware.Skipper, path string) bool {
+	return skipper(echo.New().NewContext(httptest.NewRequest(http.MethodGet, path, nil), httptest.NewRecorder()))
+}
+
+func TestSkipPaths(t *testing.T) {
+	skipper := SkipPaths("/internal", "/debug/")
+	tests := map[string]bool{
+		"/internal":         true,
+		"/internal/":        true,
+		"/internal/metrics": true,
+		"/internals":        false,
+		"/debug":            true,
+		"/debug/pprof":      true,
+		"/api/internal":     false,
+		"/":                 false,
+	}
+	for path, want := range tests {
+		if got := skips(skipper, path); got != want {
+			t.Errorf("SkipPaths skips %q = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSkipExactPaths(t *testing.T) {
+	skipper := SkipExactPaths("/health", "/ready/")
+	tests := map[string]bool{
+		"/health":        true,
+		"/health/":       true,
+		"/ready":         true,
+		"/health/detail": false,
+		"/healthz":       false,
+	}
+	for path, want := range tests {
+		if got := skips(skipper, path); got != want {
+			t.Errorf("SkipExactPaths skips %q = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestSkipper(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{Skipper: SkipPaths("/internal")})
+	e.GET("/internal/metrics", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET("/api", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/internal/metrics")
+	get(e, "/api")
+
+	if got := routes(t, reader); len(got) != 1 || got["/api"] != 1 {
+		t.Fatalf("routes = %v, want only /api", got)
+	}
+}
+
+func TestCountSkipped(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{Skipper: SkipExactPaths("/health"), CountSkipped: true})
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.HEAD("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/health")
+	get(e, "/health")
+	serve(e, httptest.NewRequest(http.MethodHead, "/health", nil))
+
+	metrics := collect(t, reader)
+	methods := make(map[string]int64)
+	for _, point := range sumPoints(t, metrics, metricSkippedRequestsTotal) {
+		if point.Attributes.Len() != 1 {
+			t.Errorf("skipped_requests_total attributes = %v, want only http.request.method", point.Attributes.ToSlice())
+		}
+		method, _ := point.Attributes.Value(semconv.HTTPRequestMethodKey)
+		methods[method.AsString()] = point.Value
+	}
+	if want := map[string]int64{http.MethodGet: 2, http.MethodHead: 1}; !maps.Equal(methods, want) {
+		t.Fatalf("skipped_requests_total = %v, want %v", methods, want)
+	}
+	if m, ok := metrics[metricHTTPRequestsTotal]; ok && len(m.Data.(metricdata.Sum[int64]).DataPoints) > 0 {
+		t.Fatal("requests_total recorded for skipped requests")
+	}
+}
@@ -0,0 +1,26 @@
+package otelmetricsecho
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanRoute returns the http.route attribute of the span in ctx, or empty string when the span is not
+// recording or does not expose its attributes. SDK spans expose them through ReadOnlySpan.
+func spanRoute(ctx context.Context) string {
+	span, ok := trace.SpanFromContext(ctx).(interface{ Attributes() []attribute.KeyValue })
+	if !ok {
+		return ""
+	}
+
+	for _, attr := range span.Attributes() {
+		if attr.Key == semconv.HTTPRouteKey {
+			return attr.Value.AsString()
+		}
+	}
+
+	return ""
+}
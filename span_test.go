@@ -0,0 +1,61 @@
+package otelmetricsecho
+
+import (
+	"maps"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withSpan starts a span with the http.route attribute, when not empty, on the request context before calling next, like a tracing middleware
+func withSpan(tracer trace.Tracer, route string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var opts []trace.SpanStartOption
+			if route != "" {
+				opts = append(opts, trace.WithAttributes(semconv.HTTPRoute(route)))
+			}
+			ctx, span := tracer.Start(c.Request().Context(), "request", opts...)
+			defer span.End()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+func TestRouteFromSpan(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	e, reader := newTestEcho(t, MiddlewareConfig{RouteFromSpan: true})
+	e.Pre(withSpan(tracer, "/items/{id}"))
+	e.GET("/items/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/items/1")
+
+	if got, want := routes(t, reader), map[string]int64{"/items/{id}": 1}; !maps.Equal(got, want) {
+		t.Fatalf("routes = %v, want %v", got, want)
+	}
+}
+
+func TestRouteFromSpanFallback(t *testing.T) {
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	e, reader := newTestEcho(t, MiddlewareConfig{RouteFromSpan: true})
+	e.Pre(withSpan(tracer, ""))
+	e.GET("/items/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/items/1")
+
+	// spans without the attribute, and requests without a span, use the matched route
+	e2, reader2 := newTestEcho(t, MiddlewareConfig{RouteFromSpan: true})
+	e2.GET("/items/:id", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e2, "/items/2")
+
+	for _, r := range []*sdkmetric.ManualReader{reader, reader2} {
+		if got, want := routes(t, r), map[string]int64{"/items/:id": 1}; !maps.Equal(got, want) {
+			t.Fatalf("routes = %v, want %v", got, want)
+		}
+	}
+}
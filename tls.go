@@ -0,0 +1,22 @@
+package otelmetricsecho
+
+import (
+	"crypto/tls"
+)
+
+// tlsProtocolVersion returns the TLS version in the format of the tls.protocol.version semantic convention,
+// e.g. "1.3". Unknown versions return empty string.
+func tlsProtocolVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "1.0"
+	case tls.VersionTLS11:
+		return "1.1"
+	case tls.VersionTLS12:
+		return "1.2"
+	case tls.VersionTLS13:
+		return "1.3"
+	}
+
+	return ""
+}
@@ -0,0 +1,53 @@
+package otelmetricsecho
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestTLSProtocolVersion(t *testing.T) {
+	tests := map[uint16]string{
+		tls.VersionTLS10: "1.0",
+		tls.VersionTLS11: "1.1",
+		tls.VersionTLS12: "1.2",
+		tls.VersionTLS13: "1.3",
+		0:                "",
+	}
+	for version, want := range tests {
+		if got := tlsProtocolVersion(version); got != want {
+			t.Errorf("tlsProtocolVersion(%#x) = %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestTLSAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{TLSAttribute: true})
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+	serve(e, req)
+	get(e, "/")
+
+	points := sumPoints(t, collect(t, reader), metricHTTPRequestsTotal)
+	if len(points) != 2 {
+		t.Fatalf("requests_total has %d points, want 2", len(points))
+	}
+	for _, point := range points {
+		secure, _ := point.Attributes.Value(attrTLS)
+		if secure.AsBool() {
+			assertAttr(t, point.Attributes, attrTLSVersion, attribute.StringValue("1.3"))
+		} else {
+			assertAttr(t, point.Attributes, attrTLS, attribute.BoolValue(false))
+			assertNoAttr(t, point.Attributes, attrTLSVersion)
+		}
+	}
+
+	e, reader = newTestEcho(t, MiddlewareConfig{})
+	serve(e, req)
+	assertNoAttr(t, singleSum(t, collect(t, reader), metricHTTPRequestsTotal).Attributes, attrTLS)
+}
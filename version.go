@@ -0,0 +1,4 @@
+package otelmetricsecho
+
+// Version is the version of the middleware, reported as the instrumentation scope version.
+const Version = "0.1.0"
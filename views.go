@@ -0,0 +1,33 @@
+package otelmetricsecho
+
+import (
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// SummaryView returns views for dashboards expecting quantiles of the request duration. The SDK has no
+// summary aggregation and never computes quantiles client-side, so unlike a Prometheus summary the views
+// take no list of quantiles: they switch the request duration histograms, including the per-method ones
+// and any Namespace prefix, to base-2 exponential histograms instead. Their fine-grained buckets let the
+// backend compute any quantile at query time with a small relative error, e.g. with histogram_quantile in
+// Prometheus. Pass the views to sdkmetric.NewMeterProvider with sdkmetric.WithView.
+//
+// The views only apply to the meter called name, the MiddlewareConfig.MeterName of the middleware, so
+// histograms of other libraries with matching names are left as they are. An empty name selects the
+// default meter name.
+func SummaryView(name string) []sdkmetric.View {
+	if name == "" {
+		name = meterName
+	}
+
+	return []sdkmetric.View{
+		sdkmetric.NewView(
+			sdkmetric.Instrument{
+				Name:  "*request_duration_*",
+				Kind:  sdkmetric.InstrumentKindHistogram,
+				Scope: instrumentation.Scope{Name: name},
+			},
+			sdkmetric.Stream{Aggregation: sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}},
+		),
+	}
+}
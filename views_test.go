@@ -0,0 +1,86 @@
+package otelmetricsecho
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestSummaryView(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mw, err := MiddlewareConfig{
+		MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(SummaryView("")...)),
+		Namespace:     "api",
+	}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	duration, ok := metrics["api_"+metricHTTPRequestDurationSeconds].Data.(metricdata.ExponentialHistogram[float64])
+	if !ok {
+		t.Fatalf("request duration is %T, want an exponential histogram", metrics["api_"+metricHTTPRequestDurationSeconds].Data)
+	}
+	if len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 1 {
+		t.Fatalf("request duration data points = %+v, want a single request", duration.DataPoints)
+	}
+	for _, name := range []string{metricHTTPRequestSizeBytes, metricHTTPResponseSizeBytes} {
+		if _, ok := metrics["api_"+name].Data.(metricdata.Histogram[float64]); !ok {
+			t.Errorf("%s is %T, want it left an explicit bucket histogram", name, metrics["api_"+name].Data)
+		}
+	}
+}
+
+func TestSummaryViewPerMethod(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mw, err := MiddlewareConfig{
+		MeterProvider:               sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(SummaryView("")...)),
+		SeparateHistogramsPerMethod: true,
+	}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	m := collect(t, reader)["request_duration_get_seconds"]
+	if _, ok := m.Data.(metricdata.ExponentialHistogram[float64]); !ok {
+		t.Fatalf("request_duration_get_seconds is %T, want an exponential histogram", m.Data)
+	}
+}
+
+func TestSummaryViewScope(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithView(SummaryView("api")...))
+	mw, err := MiddlewareConfig{MeterProvider: provider, MeterName: "api"}.ToMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := provider.Meter("other").Float64Histogram("client_request_duration_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Record(context.Background(), 1)
+	e := echo.New()
+	e.Use(mw)
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	get(e, "/")
+
+	metrics := collect(t, reader)
+	if _, ok := metrics[metricHTTPRequestDurationSeconds].Data.(metricdata.ExponentialHistogram[float64]); !ok {
+		t.Fatalf("request duration is %T, want an exponential histogram", metrics[metricHTTPRequestDurationSeconds].Data)
+	}
+	if _, ok := metrics["client_request_duration_seconds"].Data.(metricdata.Histogram[float64]); !ok {
+		t.Fatalf("histogram of another meter is %T, want it left an explicit bucket histogram", metrics["client_request_duration_seconds"].Data)
+	}
+}
@@ -0,0 +1,38 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// WebSocketHandling controls how WebSocket upgrade requests are recorded.
+type WebSocketHandling int
+
+const (
+	// WebSocketDefault records upgrade requests like any other request.
+	WebSocketDefault WebSocketHandling = iota
+	// WebSocketAttribute adds a websocket=true attribute to upgrade requests.
+	WebSocketAttribute
+	// WebSocketSeparate counts upgrade requests in websocket_connections_total and excludes them from the
+	// request duration histogram.
+	WebSocketSeparate
+)
+
+// isWebSocketUpgrade reports whether r asks for a WebSocket upgrade (Connection: Upgrade, Upgrade: websocket)
+func isWebSocketUpgrade(r *http.Request) bool {
+	if !strings.EqualFold(r.Header.Get(echo.HeaderUpgrade), "websocket") {
+		return false
+	}
+
+	for _, value := range r.Header.Values(echo.HeaderConnection) {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
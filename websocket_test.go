@@ -0,0 +1,77 @@
+package otelmetricsecho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.23.0"
+)
+
+func webSocketRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set(echo.HeaderConnection, "keep-alive, Upgrade")
+	req.Header.Set(echo.HeaderUpgrade, "websocket")
+
+	return req
+}
+
+func TestIsWebSocketUpgrade(t *testing.T) {
+	if !isWebSocketUpgrade(webSocketRequest()) {
+		t.Fatal("upgrade request not detected")
+	}
+
+	req := webSocketRequest()
+	req.Header.Set(echo.HeaderConnection, "keep-alive")
+	if isWebSocketUpgrade(req) {
+		t.Fatal("request without Connection: Upgrade detected")
+	}
+
+	req = webSocketRequest()
+	req.Header.Set(echo.HeaderUpgrade, "h2c")
+	if isWebSocketUpgrade(req) {
+		t.Fatal("h2c upgrade detected as WebSocket")
+	}
+}
+
+func TestWebSocketAttribute(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{WebSocketHandling: WebSocketAttribute})
+	e.GET("/ws", func(c echo.Context) error {
+		if isWebSocketUpgrade(c.Request()) {
+			return c.NoContent(http.StatusSwitchingProtocols)
+		}
+		return c.NoContent(http.StatusUpgradeRequired)
+	})
+	serve(e, webSocketRequest())
+	get(e, "/ws")
+
+	points := sumPoints(t, collect(t, reader), metricHTTPRequestsTotal)
+	if len(points) != 2 {
+		t.Fatalf("requests_total has %d data points, want 2", len(points))
+	}
+	for _, point := range points {
+		status, _ := point.Attributes.Value(semconv.HTTPResponseStatusCodeKey)
+		if status.AsInt64() == http.StatusSwitchingProtocols {
+			assertAttr(t, point.Attributes, attrWebSocket, attribute.BoolValue(true))
+		} else {
+			assertNoAttr(t, point.Attributes, attrWebSocket)
+		}
+	}
+}
+
+func TestWebSocketSeparate(t *testing.T) {
+	e, reader := newTestEcho(t, MiddlewareConfig{WebSocketHandling: WebSocketSeparate})
+	e.GET("/ws", func(c echo.Context) error { return c.NoContent(http.StatusSwitchingProtocols) })
+	serve(e, webSocketRequest())
+
+	metrics := collect(t, reader)
+	attrs := singleSum(t, metrics, metricWebSocketConnectionsTotal).Attributes
+	assertAttr(t, attrs, semconv.HTTPRouteKey, attribute.StringValue("/ws"))
+	assertAttr(t, attrs, semconv.HTTPResponseStatusCodeKey, attribute.IntValue(http.StatusSwitchingProtocols))
+	if _, ok := metrics[metricHTTPRequestDurationSeconds]; ok {
+		t.Fatal("upgrade request recorded in request_duration_seconds")
+	}
+	singleSum(t, metrics, metricHTTPRequestsTotal)
+}